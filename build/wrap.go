@@ -4,19 +4,31 @@
 package main
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 )
 
 // nobuild can be used to prevent the wrappers from triggering a build after
@@ -25,22 +37,228 @@ import (
 var nobuild = flag.Bool("nobuild", false, "Prevents the wrappers from building")
 var genLock = flag.Bool("update", false, "Pulls new commits, if unset the libs commits will be taken from lock.json.")
 
+// torVersion can be used to override the version Tor reports about itself (in
+// its handshakes, descriptors and `GETINFO version`). Blending in with a stock
+// Tor release hides the embedding, but a version no real release ever had will
+// make the node stand out instead, so pick a value matching an actual release.
+var torVersion = flag.String("tor-version", "", "Overrides the version string compiled into Tor (e.g. 0.4.7.13)")
+
+// conflux can be used to compile Tor with its multipath circuit support forced
+// on or off, instead of following the network consensus (the default). Tor does
+// not allow conflux to be compiled out, so this changes the ConfluxEnabled option
+// default instead, which is still overridable from the torrc.
+var conflux = flag.String("conflux", "auto", "Default state of Tor's conflux (multipath) support: auto, on or off")
+
+// listTargets can be used by tooling (e.g. CI matrix generators) to discover the
+// supported build targets, their architectures and the build tags they emit.
+var listTargets = flag.Bool("list-targets", false, "Prints the supported targets and architectures as JSON and exits")
+
+// report can be used to review what a regeneration would change. The wrapping is
+// done in a temporary directory and only a summary of the differences against
+// the committed files is printed, leaving the repository untouched.
+var report = flag.Bool("report", false, "Generates into a temporary directory and reports the changes against the committed files")
+
+// plan can be used to preview the blast radius of a regeneration (e.g. a Tor bump)
+// before running it for real. It implies report, additionally listing the sources
+// each library would have wrapped, as scraped from the make dry runs.
+var plan = flag.Bool("plan", false, "Lists the sources that would be wrapped and reports the changes, leaving the repository untouched")
+
+// torRepo can be used to clone Tor from a specific repository (e.g. a local mirror
+// in an air-gapped environment) instead of the official one and its mirrors.
+var torRepo = flag.String("tor-repo", "", "Overrides the repository Tor is cloned from, disabling the mirror fallback")
+
+// torRef can be used to wrap a different Tor branch, tag or commit than the
+// default maintenance branch. It takes precedence over lock.json, so combined
+// with --update it pulls and locks the requested revision.
+var torRef = flag.String("tor-ref", "", "Tor branch, tag or full commit hash to wrap (default "+defaultTorRef+")")
+
+// opensslRepo can be used to wrap an OpenSSL fork (e.g. a hardened one) instead of
+// the upstream library. Forks not following the upstream branch naming need an
+// explicit --openssl-ref too.
+var opensslRepo = flag.String("openssl-repo", "", "Overrides the repository OpenSSL is cloned from (e.g. a fork)")
+
+// opensslRef can be used to wrap a different OpenSSL branch, tag or commit than the
+// latest stable branch. Like --tor-ref, it takes precedence over lock.json.
+var opensslRef = flag.String("openssl-ref", "", "OpenSSL branch, tag or full commit hash to wrap (default: latest stable branch)")
+
+// zlibRef can be used to pin zlib (or zlib-ng with --zlib-ng) to a specific
+// release tag, branch or commit instead of the default one. Like --tor-ref, it
+// takes precedence over lock.json.
+var zlibRef = flag.String("zlib-ref", "", "zlib (or zlib-ng) branch, tag or full commit hash to wrap (e.g. v1.3.1)")
+
+// libeventRef can be used to pin libevent to a specific release tag (e.g.
+// release-2.1.12-stable), branch or commit instead of the tip of the default
+// branch. Like --tor-ref, it takes precedence over lock.json.
+var libeventRef = flag.String("libevent-ref", "", "libevent branch, tag or full commit hash to wrap (e.g. release-2.1.12-stable)")
+
+// asm can be used to build OpenSSL with its assembly code paths on the given (host)
+// architecture, which is many times faster for AES, SHA and the ECC primitives.
+// The other architectures of the target keep using the portable C sources, but
+// the assembly can only be generated by the perlasm scripts for the host.
+var asm = flag.String("asm", "", "Enables OpenSSL assembly for the given host architecture (e.g. amd64)")
+
+// zlibNg can be used to wrap zlib-ng (in zlib compatible mode) instead of the
+// reference zlib. It's a drop-in replacement with the same API, but considerably
+// faster, which matters for relays and directory caches decompressing a lot.
+var zlibNg = flag.Bool("zlib-ng", false, "Wraps zlib-ng in zlib compatible mode instead of madler/zlib")
+
+// withLzma can be used to vendor liblzma and enable Tor's LZMA directory
+// compression. Clients get by with zstd and zlib, but relays and directory
+// caches should support every method clients may request. It's opt-in, as it
+// grows the binaries.
+var withLzma = flag.Bool("with-lzma", false, "Vendors liblzma and enables Tor's LZMA compression support")
+
+// clientOnly can be used to build Tor without its relay and directory authority
+// modules (and the directory cache depending on them), similarly to configuring
+// it with --disable-module-relay. Such a Tor can only act as a client (and onion
+// service), but is considerably smaller, which matters for mobile apps.
+var clientOnly = flag.Bool("client-only", false, "Wraps Tor without its relay, directory cache and authority modules")
+
+// enableGPL can be used to configure Tor with --enable-gpl, wrapping the modules
+// it only builds when allowed to include GPL licensed code. The resulting library
+// (and every binary linking it) is then covered by the GPL instead of Tor's usual
+// 3-clause BSD license, with all the obligations that come with it.
+var enableGPL = flag.Bool("enable-gpl", false, "Wraps Tor along with its GPL licensed modules, making the library GPL covered")
+
+// extraCFlags can be used to bake additional compiler flags (e.g. -Os) into the
+// generated preambles. Cgo applies the flags of every preamble to all the C files
+// of the package, so they can't be scoped to a single library; they're recorded
+// in the Tor preamble of each target.
+var extraCFlags = flag.String("cflags", "", "Extra C compiler flags to bake into the generated preambles (e.g. \"-Os -g0\")")
+
+// sourcesDir can be used to wrap the libraries offline, from source trees (or
+// tarballs of them) fetched beforehand, instead of cloning them from upstream.
+// The configuration and wrapping steps run exactly as for a fresh clone.
+var sourcesDir = flag.String("sources-dir", "", "Folder with pre-fetched library sources (<lib> trees or <lib>.tar.gz) to wrap offline")
+
+// fetchOnly can be used to snapshot the library sources into the sources folder
+// without wrapping them, so a later offline run can reproduce the same build.
+var fetchOnly = flag.Bool("fetch-only", false, "Fetches the library sources into --sources-dir and exits without wrapping")
+
+// allowSourceDrop can be used to accept a sharp drop in the number of sources
+// wrapped from a library compared to the count recorded in lock.json, when an
+// upstream update legitimately removed a lot of them.
+var allowSourceDrop = flag.Bool("allow-source-drop", false, "Accepts wrapping considerably fewer sources than recorded in lock.json")
+
+// cloneAttempts can be used to retry the cloning of the libraries on transient
+// network failures (e.g. a flaky proxy), backing off exponentially in between.
+var cloneAttempts = flag.Int("clone-attempts", 3, "Number of attempts to clone each library repository before giving up")
+
+// noConfigure can be used to regenerate the wrappers on a host lacking the build
+// environment of the autoconf based libraries (libevent, liblzma and Tor). Their
+// configure scripts and make dry runs are skipped, reusing the sources recorded
+// in manifest.json by a previous run instead. The config headers are committed
+// anyway, so only the list of sources is needed.
+var noConfigure = flag.Bool("no-configure", false, "Skips autogen/configure, reusing the sources recorded in manifest.json")
+
+// minimalOpenSSL can be used to drop the OpenSSL algorithms Tor never uses (e.g.
+// IDEA, CAST, SEED, Camellia, Whirlpool) from the wrapped library, shrinking the
+// binaries, which matters on mobile.
+var minimalOpenSSL = flag.Bool("minimal-openssl", false, "Omits the OpenSSL algorithms and features Tor doesn't use")
+
+// verbose can be used to follow the progress of the libraries through the long
+// running clone, configure and wrap stages, with their timings, to tell which
+// one is stuck when a run stalls (the libraries are wrapped concurrently).
+var verbose = flag.Bool("verbose", false, "Logs the stages each library goes through, along with their timings")
+
+// reuseClones can be used to iterate on the wrapping without cloning every library
+// again on each run. The git metadata of the clones is kept in the target folder
+// and a clone already at the locked commit is restored and reused instead of
+// fetched anew. The metadata must not be committed, regenerate without the flag
+// before doing so.
+var reuseClones = flag.Bool("reuse-clones", false, "Reuses the library clones of a previous run if they are at the locked commits")
+
+// verifyAll can be used to check the generated package against every platform the
+// target declares, not only the host, catching regenerations which compile on
+// one but break another (e.g. ios). Platforms without a C cross compiler are
+// skipped, point CC_<goos>_<goarch> (e.g. CC_android_arm64) at one to add them.
+var verifyAll = flag.Bool("verify-all", false, "Vets and builds the generated package for every platform of the target the toolchain allows")
+
 func main() {
 	flag.Parse()
-	var lock *lockJson
-	if !*genLock {
-		lock = &lockJson{}
-		f, err := os.Open("lock.json")
-		if err != nil {
-			panic(err)
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "wrap: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the wrapping based on the command line flags. It's separate from
+// main so the failures can be reported cleanly and the deferred cleanups run.
+func run() error {
+	if *listTargets {
+		return printTargets()
+	}
+	if *torVersion != "" && !torVersionRegexp.MatchString(*torVersion) {
+		return fmt.Errorf("invalid Tor version override: %s", *torVersion)
+	}
+	if *conflux != "auto" && *conflux != "on" && *conflux != "off" {
+		return fmt.Errorf("invalid conflux mode: %s", *conflux)
+	}
+	if *asm != "" && *asm != runtime.GOARCH {
+		return fmt.Errorf("OpenSSL assembly can only be generated for the host architecture (%s), not %s", runtime.GOARCH, *asm)
+	}
+	if *noConfigure && *zlibNg {
+		return errors.New("zlib-ng can't be wrapped without configuring it")
+	}
+	if *cloneAttempts < 1 {
+		return fmt.Errorf("invalid clone attempts: %d", *cloneAttempts)
+	}
+	if *fetchOnly && *sourcesDir == "" {
+		return errors.New("fetching the sources requires a --sources-dir to store them in")
+	}
+	if *plan {
+		if *fetchOnly || *verifyAll {
+			return errors.New("planning can't be combined with fetching or verifying")
+		}
+		*report = true
+	}
+	for _, cflag := range strings.Fields(*extraCFlags) {
+		if !strings.HasPrefix(cflag, "-") || strings.ContainsAny(cflag, "$\"'`\\") {
+			return fmt.Errorf("invalid C compiler flag: %q", cflag)
 		}
-		err = json.NewDecoder(f).Decode(lock)
-		f.Close()
+	}
+	// Make sure the external tools are around before spending time on cloning
+	if err := preflight(); err != nil {
+		return err
+	}
+	if *sourcesDir != "" {
+		// Make the path independent of the working directory (e.g. in report mode)
+		abs, err := filepath.Abs(*sourcesDir)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		*sourcesDir = abs
+		if *fetchOnly {
+			if err := os.MkdirAll(abs, 0755); err != nil {
+				return err
+			}
 		}
 	}
+	// If only a report was requested, move over into a scratch workspace
+	var root, scratch string
+	if *report {
+		var err error
+		if root, err = os.Getwd(); err != nil {
+			return err
+		}
+		if scratch, err = ioutil.TempDir("", "go-libtor-report-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(scratch)
 
+		for _, path := range []string{"build", "config", "README.md", "lock.json", "manifest.json"} {
+			if _, err := os.Stat(filepath.Join(root, path)); os.IsNotExist(err) {
+				continue
+			}
+			if err := copyTree(filepath.Join(root, path), filepath.Join(scratch, path)); err != nil {
+				return err
+			}
+		}
+		if err := os.Chdir(scratch); err != nil {
+			return err
+		}
+		*nobuild = true
+	}
 	// TarGeT stores the target to generate, the idea is a target is block of oses
 	// compatible with each others (Linux and Android, OSX and IOS)
 	var tgt string
@@ -49,134 +267,2024 @@ func main() {
 		tgt = "linux"
 	case "darwin":
 		tgt = "darwin"
+	case "windows":
+		tgt = "windows"
+	case "freebsd":
+		tgt = "freebsd"
+	case "openbsd":
+		tgt = "openbsd"
+	case "netbsd":
+		tgt = "netbsd"
 	default:
-		panic(fmt.Errorf("Sorry but your os : %s is not yet supported.", runtime.GOOS))
+		return fmt.Errorf("operating system not yet supported: %s", runtime.GOOS)
+	}
+	// Each target is locked separately, as they are generated on different hosts
+	var lock *lockJson
+	if !*genLock {
+		var err error
+		if lock, err = readLock(tgt); err != nil {
+			return err
+		}
+	}
+	// The source counts to check the wrapping against are in the lock, even when
+	// it is being updated
+	counts := lock
+	if counts == nil {
+		if locked, err := readLock(tgt); err == nil {
+			counts = locked
+		}
 	}
 
 	// Clean up any previously generated files
-	if _, err := os.Stat("libtor"); !os.IsNotExist(err) && *genLock {
+	if _, err := os.Stat("libtor"); !os.IsNotExist(err) && *genLock && !*fetchOnly {
 		os.RemoveAll("libtor")
 	}
-	// Do the same in the target directory
-	if _, err := os.Stat(tgt); !os.IsNotExist(err) {
-		os.RemoveAll(tgt)
+	// Do the same in the target directory, unless its clones are to be reused
+	if _, err := os.Stat(tgt); !os.IsNotExist(err) && !*reuseClones {
+		os.RemoveAll(tgt)
+	}
+	// Copy in the library preamble with the architecture definitions
+	if err := os.MkdirAll("libtor", 0755); err != nil {
+		return err
+	}
+	blob, _ := ioutil.ReadFile(filepath.Join("build", "libtor_preamble.go.in"))
+	if !*fetchOnly {
+		ioutil.WriteFile(filepath.Join("libtor", "libtor_preamble.go"), blob, 0644)
+	}
+
+	// Create target directory
+	if err := os.MkdirAll(tgt, 0755); err != nil {
+		return err
+	}
+
+	// Wrap each of the component libraries into megator. They are cloned and built
+	// in their own folders and only meet in the output ones, so do it concurrently.
+	var (
+		zlibVer, zlibHash         string
+		zstdVer, zstdHash         string
+		lzmaVer, lzmaHash         string
+		libeventVer, libeventHash string
+		opensslVer, opensslHash   string
+		torVer, torHash           string
+
+		wrappers errgroup.Group
+	)
+	wrappers.Go(func() (err error) {
+		defer stage("zlib", "wrapping")()
+
+		if zlibVer, zlibHash, err = wrapZlib(tgt, lock); err != nil {
+			return fmt.Errorf("zlib: %v", err)
+		}
+		return nil
+	})
+	wrappers.Go(func() (err error) {
+		defer stage("zstd", "wrapping")()
+
+		if zstdVer, zstdHash, err = wrapZstd(tgt, lock); err != nil {
+			return fmt.Errorf("zstd: %v", err)
+		}
+		return nil
+	})
+	if *withLzma {
+		wrappers.Go(func() (err error) {
+			defer stage("lzma", "wrapping")()
+
+			if lzmaVer, lzmaHash, err = wrapLzma(tgt, lock); err != nil {
+				return fmt.Errorf("lzma: %v", err)
+			}
+			return nil
+		})
+	}
+	wrappers.Go(func() (err error) {
+		defer stage("libevent", "wrapping")()
+
+		if libeventVer, libeventHash, err = wrapLibevent(tgt, lock); err != nil {
+			return fmt.Errorf("libevent: %v", err)
+		}
+		return nil
+	})
+	wrappers.Go(func() (err error) {
+		defer stage("openssl", "wrapping")()
+
+		if opensslVer, opensslHash, err = wrapOpenSSL(tgt, lock); err != nil {
+			return fmt.Errorf("openssl: %v", err)
+		}
+		return nil
+	})
+	wrappers.Go(func() (err error) {
+		defer stage("tor", "wrapping")()
+
+		if torVer, torHash, err = wrapTor(tgt, lock); err != nil {
+			return fmt.Errorf("tor: %v", err)
+		}
+		return nil
+	})
+	if err := wrappers.Wait(); err != nil {
+		return err
+	}
+	// If only the sources were requested, they are already staged, clean up
+	if *fetchOnly {
+		fmt.Printf("Fetched zlib %s, zstd %s, libevent %s, openssl %s and tor %s into %s\n", zlibHash, zstdHash, libeventHash, opensslHash, torHash, *sourcesDir)
+		return os.RemoveAll(tgt)
+	}
+	// Make sure no library silently lost a chunk of its sources
+	if err := checkWrapped(counts); err != nil {
+		return err
+	}
+
+	// Copy and fill out the libtor entrypoint wrappers, their tests and the readme
+	// template.
+	blob, _ = ioutil.ReadFile(filepath.Join("build", "libtor_external.go.in"))
+	ioutil.WriteFile(filepath.Join("libtor.go"), blob, 0644)
+	blob, _ = ioutil.ReadFile(filepath.Join("build", "libtor_internal.go.in"))
+	ioutil.WriteFile(filepath.Join("libtor", "libtor.go"), blob, 0644)
+	blob, _ = ioutil.ReadFile(filepath.Join("build", "libtor_internal_test.go.in"))
+	ioutil.WriteFile(filepath.Join("libtor", "libtor_test.go"), blob, 0644)
+	for _, name := range internalWrappers {
+		blob, _ = ioutil.ReadFile(filepath.Join("build", "libtor_"+name+".go.in"))
+		ioutil.WriteFile(filepath.Join("libtor", "libtor_"+name+".go"), blob, 0644)
+	}
+
+	if !*nobuild {
+		if err := buildCheck(tgt); err != nil {
+			return err
+		}
+	}
+	if *verifyAll {
+		if err := verifyPlatforms(tgt); err != nil {
+			return err
+		}
+	}
+
+	// Update
+	if *genLock {
+		tmpl, err := template.ParseFiles(filepath.Join("build", "README.md"))
+		if err != nil {
+			return err
+		}
+		zlibRepo := "madler/zlib"
+		if *zlibNg {
+			zlibRepo = "zlib-ng/zlib-ng"
+		}
+		buf := new(bytes.Buffer)
+		tmpl.Execute(buf, map[string]string{
+			"zlibRepo":     zlibRepo,
+			"zlibVer":      zlibVer,
+			"zlibHash":     zlibHash,
+			"zstdVer":      zstdVer,
+			"zstdHash":     zstdHash,
+			"lzmaVer":      lzmaVer,
+			"lzmaHash":     lzmaHash,
+			"libeventVer":  libeventVer,
+			"libeventHash": libeventHash,
+			"opensslVer":   opensslVer,
+			"opensslHash":  opensslHash,
+			"torVer":       torVer,
+			"torHash":      torHash,
+		})
+		ioutil.WriteFile("README.md", buf.Bytes(), 0644)
+		locked := lockJson{
+			Zstd:     zstdHash,
+			Lzma:     lzmaHash,
+			Libevent: libeventHash,
+			Openssl:  opensslHash,
+			Tor:      torHash,
+
+			Checksums: treeSums,
+			Sources:   make(map[string]int),
+		}
+		for lib, sources := range wrappedSources {
+			locked.Sources[lib] = len(sources)
+		}
+		if *zlibNg {
+			locked.ZlibNg = zlibHash
+		} else {
+			locked.Zlib = zlibHash
+		}
+		if err := writeLock(tgt, &locked); err != nil {
+			return err
+		}
+
+		// Record the exact wrapped sources alongside the lock
+		zlibLib := "zlib"
+		if *zlibNg {
+			zlibLib = "zlib-ng"
+		}
+		manifest := newManifest(tgt, map[string][2]string{
+			zlibLib:    {zlibVer, zlibHash},
+			"zstd":     {zstdVer, zstdHash},
+			"lzma":     {lzmaVer, lzmaHash},
+			"libevent": {libeventVer, libeventHash},
+			"openssl":  {opensslVer, opensslHash},
+			"tor":      {torVer, torHash},
+		})
+		buff, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		buff = append(buff, '\n')
+		ioutil.WriteFile("manifest.json", buff, 0644)
+	}
+	// If a plan was requested, list what would be wrapped before the differences
+	if *plan {
+		printPlan(counts)
+	}
+	// If a report was requested, diff the scratch output against the committed files
+	if *report {
+		if err := reportChanges(root, scratch, tgt); err != nil {
+			return fmt.Errorf("failed to report changes: %v", err)
+		}
+	}
+	return nil
+}
+
+// printPlan lists the sources wrapped from each library, along with the number of
+// sources recorded in the lock (if any) to compare against.
+func printPlan(lock *lockJson) {
+	libs := make([]string, 0, len(wrappedSources))
+	for lib := range wrappedSources {
+		libs = append(libs, lib)
+	}
+	sort.Strings(libs)
+
+	for _, lib := range libs {
+		sources := make([]string, 0, len(wrappedSources[lib]))
+		for _, source := range wrappedSources[lib] {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		if lock != nil && lock.Sources[lib] > 0 {
+			fmt.Printf("Wrapping %d %s sources (%d locked)\n", len(sources), lib, lock.Sources[lib])
+		} else {
+			fmt.Printf("Wrapping %d %s sources\n", len(sources), lib)
+		}
+		for _, source := range sources {
+			fmt.Printf("  %s\n", source)
+		}
+	}
+}
+
+// copyTree recursively copies a file or folder from src to dst. Symlinks are
+// recreated as they are instead of copying their targets, and git metadata is
+// left out (see copyClone for carrying it over).
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, blob, info.Mode().Perm())
+	})
+}
+
+// copyClone copies the checked out sources of a git clone from src to dst, and
+// recreates the git metadata with only the checked out commit, which is all the
+// wrapping needs to identify the commit and the tracked files.
+func copyClone(src, dst string) error {
+	if err := copyTree(src, dst); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"-C", dst, "init", "--quiet"},
+		{"-C", dst, "fetch", "--quiet", "--depth", "1", abs, "HEAD"},
+		{"-C", dst, "reset", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %v\n%s", args[2], err, out)
+		}
+	}
+	return nil
+}
+
+// reportChanges compares the freshly generated files in the scratch folder with
+// the ones committed in the root folder and prints a summary of the differences:
+// the files added, removed and modified, and for the modified config headers, the
+// individual macros that changed.
+func reportChanges(root, scratch, tgt string) error {
+	// Gather all the generated files relevant for the current target
+	olds, err := listGenerated(root, tgt)
+	if err != nil {
+		return err
+	}
+	news, err := listGenerated(scratch, tgt)
+	if err != nil {
+		return err
+	}
+	var added, removed, changed []string
+	for path := range news {
+		if _, ok := olds[path]; !ok {
+			added = append(added, path)
+		}
+	}
+	for path, old := range olds {
+		fresh, ok := news[path]
+		if !ok {
+			removed = append(removed, path)
+			continue
+		}
+		if !bytes.Equal(old, fresh) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	fmt.Printf("Generated files: %d added, %d removed, %d changed\n", len(added), len(removed), len(changed))
+	for _, path := range added {
+		fmt.Printf("  + %s\n", path)
+	}
+	for _, path := range removed {
+		fmt.Printf("  - %s\n", path)
+	}
+	for _, path := range changed {
+		fmt.Printf("  ~ %s\n", path)
+
+		// Config headers are what usually needs reviewing, show the macro diffs
+		if filepath.Ext(path) != ".h" || !strings.HasSuffix(strings.Split(path, string(filepath.Separator))[0], "_config") {
+			continue
+		}
+		oldMacros, newMacros := parseMacros(olds[path]), parseMacros(news[path])
+
+		var names []string
+		for name := range oldMacros {
+			names = append(names, name)
+		}
+		for name := range newMacros {
+			if _, ok := oldMacros[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			oldVal, inOld := oldMacros[name]
+			newVal, inNew := newMacros[name]
+			switch {
+			case !inOld:
+				fmt.Printf("      + #define %s %s\n", name, newVal)
+			case !inNew:
+				fmt.Printf("      - #define %s %s\n", name, oldVal)
+			case oldVal != newVal:
+				fmt.Printf("      ~ #define %s %s -> %s\n", name, oldVal, newVal)
+			}
+		}
+	}
+	return nil
+}
+
+// listGenerated collects all the files produced by the wrapper for a specific
+// target under the given root folder, keyed by their path relative to root.
+func listGenerated(root, tgt string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, dir := range []string{"libtor", tgt, "libevent_config", "openssl_config", "tor_config"} {
+		err := filepath.Walk(filepath.Join(root, dir), func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			// The library folder is shared between all targets, skip the others
+			if dir == "libtor" && !strings.HasPrefix(info.Name(), tgt+"_") && !strings.HasPrefix(info.Name(), "libtor") {
+				return nil
+			}
+			blob, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files[rel] = blob
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range []string{"libtor.go", "README.md", "lock.json", "manifest.json"} {
+		if blob, err := ioutil.ReadFile(filepath.Join(root, file)); err == nil {
+			files[file] = blob
+		}
+	}
+	return files, nil
+}
+
+// parseMacros extracts all the #define directives from a C header, mapping the
+// macro names to their values.
+func parseMacros(header []byte) map[string]string {
+	macros := make(map[string]string)
+	for _, match := range regexp.MustCompile("(?m)^\\s*#\\s*define\\s+([A-Za-z0-9_]+)(.*)$").FindAllSubmatch(header, -1) {
+		macros[string(match[1])] = strings.TrimSpace(string(match[2]))
+	}
+	return macros
+}
+
+// torVersionRegexp matches the version strings Tor itself is able to parse. Any
+// override must conform, otherwise remote relays and Tor's own recommended
+// version checks will choke on it.
+var torVersionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(\.[0-9]+)?(-[a-zA-Z0-9]+)?$`)
+
+// buildCheck ensures the wrapped target builds. Darwin is checked for both Intel
+// and Apple Silicon, since the sources are shared by universal binaries and the
+// host compiler can target either via -arch.
+func buildCheck(tgt string) error {
+	arches := []string{""}
+	if tgt == "darwin" && runtime.GOOS == "darwin" {
+		arches = []string{"amd64", "arm64"}
+	}
+	for _, arch := range arches {
+		builder := exec.Command("go", "build", ".")
+		builder.Stdout = os.Stdout
+		builder.Stderr = os.Stderr
+
+		if arch != "" {
+			clang := map[string]string{"amd64": "x86_64", "arm64": "arm64"}[arch]
+			builder.Env = append(os.Environ(), "CGO_ENABLED=1", "GOARCH="+arch, "CC=clang -arch "+clang)
+		}
+		if err := builder.Run(); err != nil {
+			if arch != "" {
+				return fmt.Errorf("build check failed for %s: %v", arch, err)
+			}
+			return fmt.Errorf("build check failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// verifyPlatforms vets and builds the generated package for each platform declared
+// by the target's build tags which the host has a C compiler for, stopping at the
+// first one failing.
+func verifyPlatforms(tgt string) error {
+	var verified, skipped []string
+	for _, platform := range targetPlatforms(tgt) {
+		goos, goarch := platform[0], platform[1]
+
+		// Apple Silicon simulators share ios/arm64 with devices, check both
+		variants := []string{""}
+		if goos == "ios" && goarch == "arm64" {
+			variants = append(variants, simulatorTag)
+		}
+		for _, tag := range variants {
+			name, suffix := goos+"/"+goarch, ""
+			if tag != "" {
+				name, suffix = name+","+tag, "_"+tag
+			}
+			cc, ok := crossCompiler(goos, goarch, tag == simulatorTag)
+			if !ok {
+				fmt.Printf("Skipping %s: no C compiler (set CC_%s_%s%s)\n", name, goos, goarch, suffix)
+				skipped = append(skipped, name)
+				continue
+			}
+			env := append(os.Environ(), "CGO_ENABLED=1", "GOOS="+goos, "GOARCH="+goarch)
+			if cc != "" {
+				env = append(env, "CC="+cc)
+			}
+			for _, step := range []string{"vet", "build"} {
+				fmt.Printf("Verifying %s (go %s)\n", name, step)
+
+				checker := exec.Command("go", step, "-tags", tag, ".", "./libtor")
+				checker.Env = env
+				checker.Stdout = os.Stdout
+				checker.Stderr = os.Stderr
+
+				if err := checker.Run(); err != nil {
+					return fmt.Errorf("verification failed for %s (go %s): %v", name, step, err)
+				}
+			}
+			verified = append(verified, name)
+		}
+	}
+	fmt.Printf("Verified %s\n", strings.Join(verified, ", "))
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped %s\n", strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+// targetPlatforms expands the build tags of a target into the GOOS/GOARCH pairs it
+// supports, dropping any the Go toolchain doesn't know (e.g. android/mipsle).
+func targetPlatforms(tgt string) [][2]string {
+	known := make(map[string]bool)
+	if out, err := exec.Command("go", "tool", "dist", "list").Output(); err == nil {
+		for _, platform := range strings.Fields(string(out)) {
+			known[platform] = true
+		}
+	}
+	var (
+		platforms [][2]string
+		seen      = make(map[[2]string]bool)
+	)
+	for _, clause := range strings.Fields(targetFilters[tgt]) {
+		tags := strings.Split(clause, ",")
+
+		arches := tags[1:]
+		if len(arches) == 0 {
+			arches = targetArches(tgt)
+		}
+		for _, arch := range arches {
+			platform := [2]string{tags[0], arch}
+			if seen[platform] || (len(known) > 0 && !known[tags[0]+"/"+arch]) {
+				continue
+			}
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// simulatorTag is the build tag selecting the iOS simulator configuration on
+// ios/arm64, which Go can't tell apart from a device build on its own. Intel
+// simulators (ios/amd64) always get it, there being no such devices.
+const simulatorTag = "iossimulator"
+
+// crossCompiler returns the C compiler to build a platform with, empty for the
+// default one. A CC_<goos>_<goarch> environment variable (suffixed by _iossimulator
+// for the simulator) takes precedence, else only the host and, on a Mac, the Apple
+// platforms are buildable.
+func crossCompiler(goos, goarch string, simulator bool) (string, bool) {
+	env := "CC_" + goos + "_" + goarch
+	if simulator {
+		env += "_" + simulatorTag
+	}
+	if cc := os.Getenv(env); cc != "" {
+		return cc, true
+	}
+	if goos == runtime.GOOS && goarch == runtime.GOARCH {
+		return "", true
+	}
+	clang := map[string]string{"amd64": "x86_64", "arm64": "arm64"}[goarch]
+	if runtime.GOOS != "darwin" || clang == "" {
+		return "", false
+	}
+	switch goos {
+	case "darwin":
+		return "clang -arch " + clang, true
+	case "ios":
+		sdk := "iphoneos"
+		if goarch == "amd64" || simulator {
+			sdk = "iphonesimulator"
+		}
+		return "xcrun --sdk " + sdk + " clang -arch " + clang, true
+	}
+	return "", false
+}
+
+// internalWrappers is the list of hand written Go sources (build/libtor_*.go.in)
+// that are copied verbatim into the internal libtor package next to the main
+// entrypoint wrapper.
+var internalWrappers = []string{"circuit", "config", "config_test", "control", "diagnostics", "entropy", "geoip", "heartbeat", "instance", "lockfile", "onion", "tor", "torrc", "transport", "verify"}
+
+// targetFilters maps a build target to the builds tags to apply to it
+var targetFilters = map[string]string{
+	"linux":   "linux android",
+	"darwin":  "darwin,amd64 darwin,arm64 ios,amd64 ios,arm64",
+	"windows": "windows,amd64 windows,386",
+	"freebsd": "freebsd,amd64 freebsd,arm64",
+	"openbsd": "openbsd,amd64 openbsd,arm64",
+	"netbsd":  "netbsd,amd64 netbsd,arm64",
+}
+
+// Configuration header variants for each library, identified by the file name
+// suffixes used in the config folder. The bare variant is the dispatcher which
+// includes the correct one based on the ARCH_* define from the libtor preamble.
+var (
+	libeventConfigs   = []string{"", ".linux64", ".linux32", ".android64", ".android32", ".macos64", ".ios64", ".windows64", ".windows32", ".freebsd64", ".openbsd64", ".netbsd64"}
+	opensslDsoConfigs = []string{"", ".linux", ".darwin", ".windows"}
+	opensslBnConfigs  = []string{"", ".x64", ".x86", ".mingw64"}
+	opensslConfigs    = []string{"", ".x64", ".x86", ".android32", ".mips64", ".mips32", ".ppc64le", ".s390x", ".macos64", ".ios64", ".mingw64", ".mingw", ".bsd64"}
+	opensslInfConfigs = []string{"", ".x64", ".x86", ".android32", ".mips64", ".mips32", ".ppc64le", ".s390x", ".macos64", ".macos64arm64", ".ios64", ".iossim64", ".mingw64", ".mingw", ".bsd64"}
+	torConfigs        = []string{"", ".linux64", ".linux32", ".linux64mips", ".linux32mips", ".linux64ppc", ".linux64s390x", ".android64", ".android32", ".android32x86", ".macos64", ".macos64arm64", ".ios64", ".windows64", ".windows32", ".freebsd64", ".openbsd64", ".netbsd64"}
+)
+
+// donnaArches64 and donnaArches32 are the architectures the 64 and 32 bit flavors
+// of the ed25519 donna implementation get wrapped for. Their union is the set of
+// architectures supported by all targets.
+var (
+	donnaArches64 = []string{"amd64", "arm64", "riscv64", "mips64le", "ppc64le", "s390x"}
+	donnaArches32 = []string{"386", "arm", "mipsle"}
+)
+
+// targetArches returns the architectures supported by a build target. If the
+// target filter restricts architectures, those are used, otherwise every arch
+// the Tor wrapping supports is.
+func targetArches(tgt string) []string {
+	all := append(append([]string{}, donnaArches64...), donnaArches32...)
+
+	var arches []string
+	for _, arch := range all {
+		for _, clause := range strings.Fields(targetFilters[tgt]) {
+			for _, tag := range strings.Split(clause, ",") {
+				if tag == arch {
+					arches = append(arches, arch)
+				}
+			}
+		}
+	}
+	if len(arches) == 0 {
+		arches = all
+	}
+	// Deduplicate, since the same arch may appear in multiple clauses
+	sort.Strings(arches)
+	unique := arches[:0]
+	for i, arch := range arches {
+		if i == 0 || arches[i-1] != arch {
+			unique = append(unique, arch)
+		}
+	}
+	return unique
+}
+
+// printTargets writes the supported targets, their architectures and the build
+// tags they emit to stdout as JSON.
+func printTargets() error {
+	type target struct {
+		Tags   []string `json:"tags"`
+		Arches []string `json:"arches"`
+	}
+	targets := make(map[string]target)
+	for tgt, filter := range targetFilters {
+		targets[tgt] = target{
+			Tags:   strings.Fields(filter),
+			Arches: targetArches(tgt),
+		}
+	}
+	blob, err := json.MarshalIndent(targets, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(blob))
+	return nil
+}
+
+// lockJson stores the commits for later reuse.
+type lockJson struct {
+	Zlib     string `json:"zlib,omitempty"`
+	ZlibNg   string `json:"zlib-ng,omitempty"`
+	Zstd     string `json:"zstd"`
+	Lzma     string `json:"lzma,omitempty"`
+	Libevent string `json:"libevent"`
+	Openssl  string `json:"openssl"`
+	Tor      string `json:"tor"`
+
+	// Checksums are the SHA-256 sums of the wrapped source trees of each library,
+	// guarding against a compromised or rewritten remote serving different code
+	// for the same commit.
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// Sources are the number of sources wrapped from each library, guarding
+	// against the scraping of the make output silently losing some of them when
+	// upstream changes its build system.
+	Sources map[string]int `json:"sources,omitempty"`
+}
+
+// sharedLockTargets are the targets that shared a single lock before they were
+// locked separately, which a lock.json predating the split still applies to.
+var sharedLockTargets = []string{"linux", "darwin"}
+
+// readLocks loads the locks of all the targets from lock.json. A lock predating
+// the per-target layout, holding the commits at the top level, is returned as
+// shared instead, applying to any target.
+func readLocks() (locks map[string]*lockJson, shared *lockJson, err error) {
+	blob, err := ioutil.ReadFile("lock.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &entries); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse lock file: %v", err)
+	}
+	if _, ok := entries["tor"]; ok {
+		shared = new(lockJson)
+		if err := json.Unmarshal(blob, shared); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse lock file: %v", err)
+		}
+		return nil, shared, nil
+	}
+	locks = make(map[string]*lockJson)
+	if err := json.Unmarshal(blob, &locks); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse lock file: %v", err)
+	}
+	return locks, nil, nil
+}
+
+// readLock loads the lock of a single target from lock.json.
+func readLock(tgt string) (*lockJson, error) {
+	locks, shared, err := readLocks()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to open lock file: %v", err)
+		}
+		return nil, err
+	}
+	if shared != nil {
+		return shared, nil
+	}
+	lock, ok := locks[tgt]
+	if !ok {
+		return nil, fmt.Errorf("no lock for target %s in lock file, create one with --update", tgt)
+	}
+	return lock, nil
+}
+
+// writeLock stores the lock of a target into lock.json, leaving the ones of the
+// other targets as they are. A shared lock is split up, keeping it for the other
+// targets that used it.
+func writeLock(tgt string, lock *lockJson) error {
+	locks, shared, err := readLocks()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if locks == nil {
+		locks = make(map[string]*lockJson)
+	}
+	if shared != nil {
+		for _, other := range sharedLockTargets {
+			locks[other] = shared
+		}
+	}
+	locks[tgt] = lock
+
+	blob, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile("lock.json", append(blob, '\n'), 0644)
+}
+
+// manifestJson is a structured record of the wrapped sources of each library,
+// for tooling that needs to know the exact compilation units (e.g. SBOMs).
+type manifestJson struct {
+	Target    string                      `json:"target"`
+	Libraries map[string]*manifestLibrary `json:"libraries"`
+}
+
+// manifestLibrary is the record of a single wrapped library.
+type manifestLibrary struct {
+	Version string            `json:"version"`
+	Commit  string            `json:"commit"`
+	Sources []*manifestSource `json:"sources"`
+}
+
+// manifestSource is a single wrapped source file and the Go wrapper including it.
+type manifestSource struct {
+	Path    string `json:"path"`
+	Wrapper string `json:"wrapper"`
+}
+
+// newManifest assembles the build manifest from the sources recorded during the
+// wrapping. The sources are sorted by wrapper name for a reproducible output.
+func newManifest(tgt string, versions map[string][2]string) *manifestJson {
+	manifest := &manifestJson{
+		Target:    tgt,
+		Libraries: make(map[string]*manifestLibrary),
+	}
+	for lib, sources := range wrappedSources {
+		library := &manifestLibrary{
+			Version: versions[lib][0],
+			Commit:  versions[lib][1],
+		}
+		for wrapper, path := range sources {
+			library.Sources = append(library.Sources, &manifestSource{Path: path, Wrapper: wrapper})
+		}
+		sort.Slice(library.Sources, func(i, j int) bool {
+			return library.Sources[i].Wrapper < library.Sources[j].Wrapper
+		})
+		manifest.Libraries[lib] = library
+	}
+	return manifest
+}
+
+// recordedSources loads the sources wrapped from a library by a previous run from
+// manifest.json, in the form scraped from the make dry runs: relative to the dir
+// the make ran in, without the .c extension.
+func recordedSources(lib string, dir string) ([][]string, error) {
+	blob, err := ioutil.ReadFile("manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("no recorded sources to reuse: %v", err)
+	}
+	manifest := new(manifestJson)
+	if err := json.Unmarshal(blob, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	library := manifest.Libraries[lib]
+	if library == nil || len(library.Sources) == 0 {
+		return nil, fmt.Errorf("no recorded sources in manifest.json")
+	}
+	var deps [][]string
+	for _, source := range library.Sources {
+		if path.Ext(source.Path) != ".c" {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(source.Path))
+		if err != nil {
+			return nil, err
+		}
+		rel = strings.TrimSuffix(filepath.ToSlash(rel), ".c")
+		deps = append(deps, []string{source.Path, rel})
+	}
+	return uniqueSources(deps), nil
+}
+
+// treeSums gathers the checksums of the wrapped source trees for lock.json. It's
+// guarded by outputLock as the libraries are wrapped concurrently.
+var treeSums = make(map[string]string)
+
+// trackedFiles lists the files tracked by git in a freshly cloned repository.
+func trackedFiles(dir string) (map[string]bool, error) {
+	lister := exec.Command("git", "ls-files", "-z")
+	lister.Dir = dir
+
+	out, err := lister.Output()
+	if err != nil {
+		return nil, fmt.Errorf("file listing failed: %v", err)
+	}
+	files := make(map[string]bool)
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+	return files, nil
+}
+
+// checkTree computes the checksum of the tracked sources remaining in a library
+// after wiping the non-essential files, and verifies it against the lock if one
+// was recorded. Files generated by the build are excluded, as they depend on the
+// host running the wrapping.
+func checkTree(lib string, dir string, tracked map[string]bool, lock *lockJson) error {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); tracked[rel] {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	hasher := sha256.New()
+	for _, file := range files {
+		blob, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hasher, "%s\x00%d\x00", file, len(blob))
+		hasher.Write(blob)
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+
+	outputLock.Lock()
+	treeSums[lib] = sum
+	outputLock.Unlock()
+
+	if lock != nil {
+		switch want := lock.Checksums[lib]; {
+		case want == "":
+			fmt.Printf("No checksum locked for %s, skipping verification\n", lib)
+		case want != sum:
+			return fmt.Errorf("source checksum mismatch: have %s, want %s", sum, want)
+		}
+	}
+	return nil
+}
+
+// minSources is the minimum number of C sources expected to be harvested from
+// the make dry runs of each library. The numbers are about half of what current
+// upstream versions produce, low enough to tolerate upstream refactors, but high
+// enough to catch the parsing breaking down.
+var minSources = map[string]int{
+	"zlib-ng":  15,
+	"lzma":     25,
+	"libevent": 10,
+	"openssl":  300,
+	"tor":      200,
+}
+
+// outputLock serializes the writes into the output folders shared by all the
+// libraries (libtor and the config folders), which are wrapped concurrently.
+var outputLock sync.Mutex
+
+// writeOutput writes a generated file into one of the shared output folders.
+func writeOutput(path string, blob []byte) error {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+
+	// Normalize the line endings, a Windows checkout might have converted them
+	blob = bytes.Replace(blob, []byte("\r\n"), []byte("\n"), -1)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, blob, 0644)
+}
+
+// wrappedSources gathers the C (and assembly) sources wrapped from each library,
+// mapped to the Go wrappers including them, for manifest.json. It's guarded by
+// outputLock as the libraries are wrapped concurrently.
+var wrappedSources = make(map[string]map[string]string)
+
+// writeWrapper writes a generated Go wrapper into the libtor folder, recording
+// the library source it includes (relative to the library root) for the build
+// manifest.
+func writeWrapper(lib string, source string, path string, blob []byte) error {
+	outputLock.Lock()
+	if wrappedSources[lib] == nil {
+		wrappedSources[lib] = make(map[string]string)
+	}
+	wrappedSources[lib][filepath.Base(path)] = source
+	outputLock.Unlock()
+
+	return writeOutput(path, blob)
+}
+
+// cloneRepo shallow clones a single revision of a git repository into dir. If a
+// commit is given, only that is fetched, otherwise the tip of the branch (or of
+// the default one if empty). The history is never needed, only the sources.
+func cloneRepo(url, dir, branch, commit string) error {
+	var cmds [][]string
+	if commit == "" {
+		clone := []string{"clone", "--depth", "1"}
+		if branch != "" {
+			clone = append(clone, "--branch", branch)
+		}
+		cmds = append(cmds, append(clone, url, dir))
+	} else {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		cmds = append(cmds,
+			[]string{"-C", dir, "init", "--quiet"},
+			[]string{"-C", dir, "fetch", "--depth", "1", url, commit},
+			[]string{"-C", dir, "checkout", "--quiet", "FETCH_HEAD"},
+		)
+	}
+	for _, args := range cmds {
+		cloner := exec.Command("git", args...)
+		cloner.Stdout = os.Stdout
+		cloner.Stderr = os.Stderr
+
+		if err := cloner.Run(); err != nil {
+			return fmt.Errorf("clone failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// cloneBackoff is the delay before the first retry of a failed clone, doubled
+// after every subsequent failure.
+const cloneBackoff = 2 * time.Second
+
+// cloneRetry clones a git repository via cloneRepo, retrying on failures up to
+// --clone-attempts times in total with an exponential backoff. Any partial clone
+// is wiped between attempts, so every one starts from scratch.
+func cloneRetry(url, dir, branch, commit string) error {
+	backoff := cloneBackoff
+	for attempt := 1; ; attempt++ {
+		err := cloneRepo(url, dir, branch, commit)
+		if err == nil || attempt >= *cloneAttempts {
+			return err
+		}
+		fmt.Printf("Cloning %s failed (attempt %d/%d), retrying in %v: %v\n", url, attempt, *cloneAttempts, backoff, err)
+		os.RemoveAll(dir)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// fetchRepo retrieves the sources of a library into dir, cloning them from the
+// first reachable repository of urls. With --sources-dir set, the sources staged
+// there are used instead, without touching the network, unless --fetch-only was
+// requested too, in which case the fresh clone is staged there for later use.
+func fetchRepo(lib string, urls []string, dir, branch, commit string) error {
+	if *sourcesDir != "" && !*fetchOnly {
+		defer stage(lib, "staging")()
+		return stageSources(lib, dir, commit)
+	}
+	defer stage(lib, "cloning")()
+
+	if !*reuseClones || !reuseClone(lib, dir, commit) {
+		var failures []string
+		for _, url := range urls {
+			err := cloneRetry(url, dir, branch, commit)
+			if err == nil {
+				break
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", url, err))
+			os.RemoveAll(dir)
+		}
+		if len(failures) == len(urls) {
+			return errors.New(strings.Join(failures, "; "))
+		}
+	}
+	if *fetchOnly {
+		stage := filepath.Join(*sourcesDir, lib)
+		os.RemoveAll(stage)
+		os.Remove(stage + ".tar.gz")
+
+		if err := copyClone(dir, stage); err != nil {
+			return fmt.Errorf("staging failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// reuseClone checks whether dir holds the clone of a library left behind by a
+// previous --reuse-clones run at the requested commit, restoring its pristine
+// state (undoing the wiping and configuring) if so. Otherwise any leftovers are
+// removed, making room for a fresh clone. Unpinned (--update) runs never reuse.
+func reuseClone(lib, dir, commit string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil || commit == "" {
+		os.RemoveAll(dir)
+		return false
+	}
+	parser := exec.Command("git", "rev-parse", "HEAD")
+	parser.Dir = dir
+
+	head, err := parser.Output()
+	if err != nil || string(bytes.TrimSpace(head)) != commit {
+		os.RemoveAll(dir)
+		return false
+	}
+	for _, args := range [][]string{{"reset", "--quiet", "--hard", "HEAD"}, {"clean", "--quiet", "-fdx"}} {
+		restorer := exec.Command("git", args...)
+		restorer.Dir = dir
+
+		if out, err := restorer.CombinedOutput(); err != nil {
+			fmt.Printf("Restoring the %s clone failed, cloning anew: %v\n%s", lib, err, out)
+			os.RemoveAll(dir)
+			return false
+		}
+	}
+	logf(lib, "reusing clone at %s", commit)
+	return true
+}
+
+// keepClone reports whether an entry of a library's top level folder must survive
+// the wiping of the non-essential files, which only holds for the git metadata
+// when the clones are reused by the next run.
+func keepClone(name string) bool {
+	return *reuseClones && name == ".git"
+}
+
+// stageSources copies the pre-fetched sources of a library from --sources-dir
+// into dir. They may be a checked out tree or a gzipped tarball of one, but in
+// both cases must include the git metadata, needed to identify the commit and
+// the tracked files. If a commit is requested, the staged one must match.
+func stageSources(lib, dir, commit string) error {
+	src := filepath.Join(*sourcesDir, lib)
+	if info, err := os.Stat(src); err == nil && info.IsDir() {
+		if err := copyClone(src, dir); err != nil {
+			return fmt.Errorf("staging failed: %v", err)
+		}
+	} else if _, err := os.Stat(src + ".tar.gz"); err == nil {
+		if err := extractTarball(src+".tar.gz", dir); err != nil {
+			return fmt.Errorf("staging failed: %v", err)
+		}
+	} else {
+		return fmt.Errorf("no sources found in %s (%s or %s.tar.gz)", *sourcesDir, lib, lib)
+	}
+	if commit != "" {
+		parser := exec.Command("git", "rev-parse", "HEAD")
+		parser.Dir = dir
+
+		head, err := parser.CombinedOutput()
+		if err != nil {
+			fmt.Println(string(head))
+			return fmt.Errorf("commit lookup failed: %v", err)
+		}
+		if have := string(bytes.TrimSpace(head)); have != commit {
+			return fmt.Errorf("staged sources at commit %s, want %s", have, commit)
+		}
+	}
+	return nil
+}
+
+// extractTarball unpacks a gzipped tarball into dir, stripping the single top
+// level folder the archive is expected to contain (e.g. tar -czf zlib.tar.gz zlib).
+func extractTarball(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Strip the top level folder and refuse anything escaping the target
+		parts := strings.SplitN(filepath.ToSlash(filepath.Clean(header.Name)), "/", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		if parts[1] == ".." || strings.HasPrefix(parts[1], "../") {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(parts[1]))
+		if err := checkNoSymlinks(dir, parts[1]); err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, archive); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// Only allow relative links resolving within the target folder
+			link := filepath.ToSlash(header.Linkname)
+			if path.IsAbs(link) || filepath.IsAbs(header.Linkname) {
+				return fmt.Errorf("absolute symlink in archive: %s -> %s", header.Name, header.Linkname)
+			}
+			if resolved := path.Join(path.Dir(parts[1]), link); resolved == ".." || strings.HasPrefix(resolved, "../") {
+				return fmt.Errorf("symlink escaping archive: %s -> %s", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkNoSymlinks ensures that none of the existing components of the slash
+// separated path rel within dir is a symlink, so extracting an entry can't write
+// through one placed by an earlier entry of the same archive.
+func checkNoSymlinks(dir, rel string) error {
+	current := dir
+	for _, part := range strings.Split(rel, "/") {
+		current = filepath.Join(current, part)
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry through symlink: %s", current)
+		}
+	}
+	return nil
+}
+
+// extractVersion looks up the version of a library in one of its source files,
+// failing if the definition matched by pattern cannot be found.
+func extractVersion(blob []byte, pattern string) ([]byte, error) {
+	match := regexp.MustCompile(pattern).FindSubmatch(blob)
+	if match == nil {
+		return nil, fmt.Errorf("version not found (%s)", pattern)
+	}
+	return match[1], nil
+}
+
+// strlIncludeRegexp matches the inclusions of the bundled strlcpy and strlcat
+// fallbacks, capturing the included path.
+var strlIncludeRegexp = regexp.MustCompile(`#include "([^"]*\bstrl(?:cpy|cat)\.c)"`)
+
+// fixStrlIncludes points the inclusions of the strlcpy and strlcat fallbacks in
+// Tor's string compatibility source at the files in the tree, relative to src as
+// the wrappers include from there. Tor moves these around every now and then, so
+// the paths are resolved from the tree instead of patched blindly, failing if the
+// inclusions or the included files can't be found rather than breaking the build
+// of the platforms lacking the functions (e.g. Windows) with a missing symbol.
+func fixStrlIncludes(tgtf string) error {
+	source := filepath.Join(tgtf, "src", "lib", "string", "compat_string.c")
+
+	blob, err := ioutil.ReadFile(source)
+	if err != nil {
+		return fmt.Errorf("string compatibility source missing: %v", err)
+	}
+	matches := strlIncludeRegexp.FindAllSubmatch(blob, -1)
+	if len(matches) == 0 {
+		return fmt.Errorf("no strlcpy/strlcat inclusion found in %s", source)
+	}
+	src := filepath.Join(tgtf, "src")
+	for _, match := range matches {
+		// Find the single source in the tree the inclusion refers to
+		name := path.Base(string(match[1]))
+
+		var found []string
+		if err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && info.Name() == name {
+				found = append(found, file)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(found) != 1 {
+			return fmt.Errorf("%s included by %s: %d candidates found in the tree", name, source, len(found))
+		}
+		rel, err := filepath.Rel(src, found[0])
+		if err != nil {
+			return err
+		}
+		blob = bytes.Replace(blob, match[0], []byte(`#include "`+filepath.ToSlash(rel)+`"`), 1)
+	}
+	return ioutil.WriteFile(source, blob, 0644)
+}
+
+// makeTool returns the name of the GNU make binary. The BSDs ship their own make
+// by default, which doesn't understand --dry-run, and install GNU make as gmake.
+func makeTool() string {
+	if runtime.GOOS == "freebsd" || runtime.GOOS == "openbsd" || runtime.GOOS == "netbsd" {
+		return "gmake"
+	}
+	return "make"
+}
+
+// requiredTool is an external tool the wrapping depends on. Any of the listed
+// names will do (e.g. libtoolize is called glibtoolize by Homebrew).
+type requiredTool struct {
+	names []string // Alternative executable names of the tool
+	hint  string   // Actionable explanation of what needs the tool
+}
+
+// preflight checks that the external tools needed by the requested run are on
+// the PATH, so a missing one is reported upfront with a hint on what needs it,
+// instead of as a cryptic failure deep inside some library's build system.
+func preflight() error {
+	tools := []requiredTool{
+		{[]string{"git"}, "git is needed to fetch the libraries and identify their commits"},
+	}
+	if !*fetchOnly {
+		tools = append(tools,
+			requiredTool{[]string{makeTool()}, makeTool() + " is needed to list the sources of the libraries"},
+			requiredTool{[]string{"perl"}, "OpenSSL's Configure requires perl"},
+		)
+		if !*noConfigure {
+			autotools := "autogen.sh requires autoconf/automake/libtool; install them (or pass --no-configure to reuse the sources in manifest.json)"
+			tools = append(tools,
+				requiredTool{[]string{"autoconf"}, autotools},
+				requiredTool{[]string{"automake"}, autotools},
+				requiredTool{[]string{"libtoolize", "glibtoolize"}, autotools},
+			)
+		}
+	}
+	var missing, hints []string
+	for _, tool := range tools {
+		found := false
+		for _, name := range tool.names {
+			if _, err := exec.LookPath(name); err == nil {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		missing = append(missing, tool.names[0])
+		if len(hints) == 0 || hints[len(hints)-1] != tool.hint {
+			hints = append(hints, tool.hint)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required tools: %s\n  %s", strings.Join(missing, ", "), strings.Join(hints, "\n  "))
+	}
+	return nil
+}
+
+// stage logs the start of a step in the processing of a library if verbose output
+// was requested, returning a function that logs its end along with its duration.
+func stage(lib string, step string) func() {
+	if !*verbose {
+		return func() {}
+	}
+	logf(lib, "%s...", step)
+
+	start := time.Now()
+	return func() {
+		logf(lib, "%s (took %v)", step, time.Since(start).Round(time.Second))
+	}
+}
+
+// logf prints a progress message about a library if verbose output was requested.
+func logf(lib string, format string, args ...interface{}) {
+	if *verbose {
+		fmt.Printf("[%s] %s\n", lib, fmt.Sprintf(format, args...))
+	}
+}
+
+// checkSources ensures that the sources scraped from the make output of a lib
+// are plausible. The scraping relies on the exact output format of make, which
+// may change across versions and options (e.g. --output-sync), in which case it
+// silently matches nothing. Better to fail here than to wrap a broken library.
+func checkSources(lib string, deps [][]string) error {
+	if len(deps) < minSources[lib] {
+		return fmt.Errorf("%s: make output parsing yielded too few sources (%d, expected at least %d), make version incompatible?", lib, len(deps), minSources[lib])
+	}
+	logf(lib, "wrapping %d sources", len(deps))
+	return nil
+}
+
+// maxSourceDrop is the fraction of the sources recorded in lock.json a library
+// may lose across updates before the wrapping is deemed broken. Upstream does
+// remove files occasionally, but rarely more than a handful at once.
+const maxSourceDrop = 0.1
+
+// checkWrapped ensures that the number of sources wrapped from each library did
+// not drop sharply compared to the counts recorded in the lock. The minimums of
+// checkSources only catch the scraping breaking down entirely, this also catches
+// a regexp quietly matching a subset of the files, which otherwise only shows up
+// as undefined symbols at link time.
+func checkWrapped(lock *lockJson) error {
+	if lock == nil || *allowSourceDrop {
+		return nil
+	}
+	libs := make([]string, 0, len(wrappedSources))
+	for lib := range wrappedSources {
+		libs = append(libs, lib)
+	}
+	sort.Strings(libs)
+
+	for _, lib := range libs {
+		want, have := lock.Sources[lib], len(wrappedSources[lib])
+		if want == 0 {
+			continue
+		}
+		if float64(have) < float64(want)*(1-maxSourceDrop) {
+			return fmt.Errorf("%s: wrapped %d sources, down from %d in lock.json, make output parsing broken? (--allow-source-drop to accept)", lib, have, want)
+		}
+	}
+	return nil
+}
+
+// wrapZlib clones the zlib library into the local repository and wraps it into
+// a Go package.
+//
+// Zlib is a small and simple C library which can be wrapped by inserting an empty
+// Go file among the C sources, causing the Go compiler to pick up all the loose
+// sources and build them together into a static library.
+func wrapZlib(tgt string, lock *lockJson) (string, string, error) {
+	if *zlibNg {
+		return wrapZlibNg(tgt, lock)
+	}
+	// TarGeT Full
+	tgtf := filepath.Join(tgt, "zlib")
+
+	// If we have a commit lock, checkout these commits, unless a specific ref was
+	// requested, which is either a full commit hash or a branch or tag name.
+	var branch, lockCommit string
+	if lock != nil {
+		lockCommit = lock.Zlib
+	}
+	if *zlibRef != "" {
+		branch, lockCommit = *zlibRef, ""
+		if commitRegexp.MatchString(*zlibRef) {
+			branch, lockCommit = "", *zlibRef
+		}
+	}
+	if err := fetchRepo("zlib", []string{"https://github.com/madler/zlib"}, tgtf, branch, lockCommit); err != nil {
+		return "", "", err
+	}
+
+	// Save the latest upstream commit hash for later reference
+	parser := exec.Command("git", "rev-parse", "HEAD")
+	parser.Dir = tgtf
+
+	commit, err := parser.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(commit))
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
+	}
+	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
+
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Retrieve the version of the current commit
+	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "zlib.h"))
+	strver, err := extractVersion(conf, "define ZLIB_VERSION \"(.+)\"")
+	if err != nil {
+		return "", "", err
+	}
+
+	// Wipe everything from the library that's non-essential
+	files, err := ioutil.ReadDir(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		if keepClone(file.Name()) {
+			continue
+		}
+		if file.IsDir() {
+			os.RemoveAll(filepath.Join(tgtf, file.Name()))
+			continue
+		}
+		if ext := filepath.Ext(file.Name()); ext != ".h" && ext != ".c" {
+			os.Remove(filepath.Join(tgtf, file.Name()))
+		}
+	}
+	// Ensure the remaining sources are the ones locked, unless overridden
+	verify := lock
+	if *zlibRef != "" {
+		verify = nil
+	}
+	if err := checkTree("zlib", tgtf, tracked, verify); err != nil {
+		return "", "", err
+	}
+
+	// TarGeTFILTer
+	tgtFilt := targetFilters[tgt]
+
+	// Remove any previous zlib wrappers, they might be from zlib-ng
+	removeZlibWrappers(tgt)
+
+	// Generate Go wrappers for each C source individually
+	tmpl, err := template.New("").Parse(zlibTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if ext := filepath.Ext(file.Name()); ext == ".c" {
+			name := strings.TrimSuffix(file.Name(), ext)
+			buff := new(bytes.Buffer)
+			if err := tmpl.Execute(buff, map[string]string{
+				"TargetFilter": tgtFilt,
+				"File":         name,
+			}); err != nil {
+				return "", "", err
+			}
+			writeWrapper("zlib", name+".c", filepath.Join("libtor", tgt+"_zlib_"+name+".go"), buff.Bytes())
+		}
+	}
+
+	tmpl, err = template.New("").Parse(zlibPreamble)
+	if err != nil {
+		return "", "", err
+	}
+	buff := new(bytes.Buffer)
+	if err := tmpl.Execute(buff, map[string]string{
+		"TargetFilter": tgtFilt,
+		"Target":       tgt,
+		"Version":      string(strver),
+	}); err != nil {
+		return "", "", err
+	}
+	writeOutput(filepath.Join("libtor", tgt+"_zlib_preamble.go"), buff.Bytes())
+	return string(strver), string(commit), nil
+}
+
+// zlibPreamble is the CGO preamble injected to configure the C compiler.
+var zlibPreamble = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+
+package libtor
+
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/zlib
+#cgo CFLAGS: -DHAVE_UNISTD_H -DHAVE_STDARG_H
+*/
+import "C"
+
+func init() {
+	wrappedVersions["zlib"] = "{{.Version}}"
+}
+`
+
+// zlibTemplate is the source file template used in zlib Go wrappers.
+var zlibTemplate = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+
+package libtor
+
+/*
+#include <../zlib/{{.File}}.c>
+*/
+import "C"
+`
+
+// zlibNgBranch is the zlib-ng branch wrapped when not pinned via the lock file.
+const zlibNgBranch = "stable"
+
+// wrapZlibNg clones the zlib-ng library into the local repository and wraps it
+// into a Go package, in place of the reference zlib.
+//
+// Zlib-ng is configured in zlib compatible mode, so it exposes the exact same API
+// and headers, and Tor links against it unchanged. The SIMD optimizations are
+// disabled, as they are selected by the host's configure, leaving the portable
+// C sources: the loose ones plus the generic fallbacks under arch/generic. These
+// can be wrapped the same way as zlib, with an empty Go file for each.
+func wrapZlibNg(tgt string, lock *lockJson) (string, string, error) {
+	// TarGeT Full, shared with zlib so the include paths stay the same
+	tgtf := filepath.Join(tgt, "zlib")
+
+	// If we have a commit lock, checkout these commits, otherwise the latest
+	// stable branch, unless a specific ref was requested.
+	branch, lockCommit := zlibNgBranch, ""
+	if lock != nil {
+		lockCommit = lock.ZlibNg
+	}
+	if *zlibRef != "" {
+		branch, lockCommit = *zlibRef, ""
+		if commitRegexp.MatchString(*zlibRef) {
+			branch, lockCommit = "", *zlibRef
+		}
+	}
+	if err := fetchRepo("zlib-ng", []string{"https://github.com/zlib-ng/zlib-ng"}, tgtf, branch, lockCommit); err != nil {
+		return "", "", err
+	}
+
+	// Save the latest upstream commit hash for later reference
+	parser := exec.Command("git", "rev-parse", "HEAD")
+	parser.Dir = tgtf
+
+	commit, err := parser.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(commit))
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
+	}
+	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
+
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Configure the library for compilation, generating the compat headers
+	configure := exec.Command("./configure", "--zlib-compat", "--static", "--without-optimizations", "--without-new-strategies")
+	configure.Dir = tgtf
+	configure.Stdout = os.Stdout
+	configure.Stderr = os.Stderr
+
+	done := stage("zlib-ng", "configure")
+	if err := configure.Run(); err != nil {
+		return "", "", fmt.Errorf("configure failed: %v", err)
+	}
+	done()
+	// Retrieve the version of the current commit (the zlib one it's compatible
+	// with, suffixed by .zlib-ng)
+	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "zlib.h"))
+	strver, err := extractVersion(conf, "define ZLIB_VERSION \"(.+)\"")
+	if err != nil {
+		return "", "", err
+	}
+	// Hook the make system and gather the feature flags detected by configure
+	maker := exec.Command(makeTool(), "--dry-run", "libz.a")
+	maker.Dir = tgtf
+
+	out, err := maker.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(out))
+		return "", "", fmt.Errorf("make dry run failed: %v", err)
+	}
+	var defines []string
+	for _, match := range regexp.MustCompile(`\s-D([A-Za-z0-9_]+(?:=[^\s]+)?)`).FindAllStringSubmatch(string(out), -1) {
+		defines = append(defines, "-D"+match[1])
+	}
+	sort.Strings(defines)
+	unique := defines[:0]
+	for i, define := range defines {
+		if i == 0 || defines[i-1] != define {
+			unique = append(unique, define)
+		}
+	}
+	defines = unique
+
+	// Wipe everything from the library that's non-essential, keeping only the
+	// loose sources and the generic fallbacks of the optimized routines
+	files, err := ioutil.ReadDir(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		if keepClone(file.Name()) {
+			continue
+		}
+		if file.IsDir() {
+			if file.Name() != "arch" {
+				os.RemoveAll(filepath.Join(tgtf, file.Name()))
+			}
+			continue
+		}
+		if ext := filepath.Ext(file.Name()); ext != ".h" && ext != ".c" {
+			os.Remove(filepath.Join(tgtf, file.Name()))
+		}
+	}
+	arches, err := ioutil.ReadDir(filepath.Join(tgtf, "arch"))
+	if err != nil {
+		return "", "", err
+	}
+	for _, arch := range arches {
+		if arch.IsDir() && arch.Name() != "generic" {
+			os.RemoveAll(filepath.Join(tgtf, "arch", arch.Name()))
+			continue
+		}
+		if ext := filepath.Ext(arch.Name()); !arch.IsDir() && ext != ".h" {
+			os.Remove(filepath.Join(tgtf, "arch", arch.Name()))
+		}
+	}
+	var deps [][]string
+	for _, dir := range []string{"", "arch/generic"} {
+		files, err := ioutil.ReadDir(filepath.Join(tgtf, filepath.FromSlash(dir)))
+		if err != nil {
+			return "", "", err
+		}
+		for _, file := range files {
+			if ext := filepath.Ext(file.Name()); !file.IsDir() && ext == ".c" {
+				deps = append(deps, []string{file.Name(), path.Join(dir, strings.TrimSuffix(file.Name(), ext))})
+			} else if !file.IsDir() && ext != ".h" {
+				os.Remove(filepath.Join(tgtf, filepath.FromSlash(dir), file.Name()))
+			}
+		}
+	}
+	if err := checkSources("zlib-ng", deps); err != nil {
+		return "", "", err
+	}
+	// Ensure the remaining sources are the ones locked, unless overridden
+	verify := lock
+	if *zlibRef != "" {
+		verify = nil
+	}
+	if err := checkTree("zlib-ng", tgtf, tracked, verify); err != nil {
+		return "", "", err
+	}
+
+	// TarGeTFILTer
+	tgtFilt := targetFilters[tgt]
+
+	// Remove any previous zlib wrappers, they might be from the reference zlib
+	removeZlibWrappers(tgt)
+
+	// Generate Go wrappers for each C source individually
+	tmpl, err := template.New("").Parse(zlibTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	for _, dep := range deps {
+		buff := new(bytes.Buffer)
+		if err := tmpl.Execute(buff, map[string]string{
+			"TargetFilter": tgtFilt,
+			"File":         dep[1],
+		}); err != nil {
+			return "", "", err
+		}
+		writeWrapper("zlib-ng", dep[1]+".c", filepath.Join("libtor", tgt+"_zlib_"+strings.Replace(dep[1], "/", "_", -1)+".go"), buff.Bytes())
+	}
+
+	tmpl, err = template.New("").Parse(zlibNgPreamble)
+	if err != nil {
+		return "", "", err
+	}
+	buff := new(bytes.Buffer)
+	if err := tmpl.Execute(buff, map[string]string{
+		"TargetFilter": tgtFilt,
+		"Target":       tgt,
+		"Version":      string(strver),
+		"Defines":      strings.Join(defines, " "),
+	}); err != nil {
+		return "", "", err
+	}
+	writeOutput(filepath.Join("libtor", tgt+"_zlib_preamble.go"), buff.Bytes())
+	return string(strver), string(commit), nil
+}
+
+// removeZlibWrappers deletes any previously generated zlib wrappers of a target,
+// as the reference zlib and zlib-ng are made of different source files.
+func removeZlibWrappers(tgt string) {
+	stale, _ := filepath.Glob(filepath.Join("libtor", tgt+"_zlib_*.go"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+}
+
+// zlibNgPreamble is the CGO preamble injected to configure the C compiler for
+// zlib-ng. The defines are the ones configure detected, ZLIB_COMPAT among them.
+var zlibNgPreamble = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+
+package libtor
+
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/zlib
+#cgo CFLAGS: {{.Defines}}
+*/
+import "C"
+
+func init() {
+	wrappedVersions["zlib-ng"] = "{{.Version}}"
+}
+`
+
+// zstdDirs are the folders of the zstd library sources needed for the streaming
+// compression and decompression Tor uses. The dictionary builder, the legacy
+// format decoders and the deprecated APIs are all left out.
+var zstdDirs = map[string]bool{
+	"common":     true,
+	"compress":   true,
+	"decompress": true,
+}
+
+// wrapZstd clones the zstd library into the local repository and wraps it into
+// a Go package.
+//
+// Zstd is a self contained C library similar to zlib, but with its sources split
+// across a few folders. It can be wrapped by inserting an empty Go file for each
+// of the C sources, causing the Go compiler to pick them all up and build them
+// together into a static library. Tor uses it for compressing directory objects,
+// which makes the consensus (diff) downloads during bootstrap much smaller.
+func wrapZstd(tgt string, lock *lockJson) (string, string, error) {
+	// TarGeT Full
+	tgtf := filepath.Join(tgt, "zstd")
+
+	// If we have a commit lock, checkout these commits, otherwise the latest
+	// release (the default branch is the development one). A lock predating the
+	// zstd support can't pin it, so refuse to silently wrap whatever is current.
+	var lockCommit string
+	if lock != nil {
+		if lock.Zstd == "" {
+			return "", "", fmt.Errorf("no zstd commit in lock file for target %s, lock one with --update", tgt)
+		}
+		lockCommit = lock.Zstd
+	}
+	if err := fetchRepo("zstd", []string{"https://github.com/facebook/zstd"}, tgtf, "release", lockCommit); err != nil {
+		return "", "", err
+	}
+
+	// Save the latest upstream commit hash for later reference
+	parser := exec.Command("git", "rev-parse", "HEAD")
+	parser.Dir = tgtf
+
+	commit, err := parser.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(commit))
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
+	}
+	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
+
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Retrieve the version of the current commit
+	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "lib", "zstd.h"))
+
+	var parts []string
+	for _, part := range []string{"MAJOR", "MINOR", "RELEASE"} {
+		ver, err := extractVersion(conf, "define ZSTD_VERSION_"+part+"\\s+([0-9]+)")
+		if err != nil {
+			return "", "", err
+		}
+		parts = append(parts, string(ver))
+	}
+	strver := strings.Join(parts, ".")
+
+	// Wipe everything from the library that's non-essential
+	files, err := ioutil.ReadDir(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		if file.Name() != "lib" && !keepClone(file.Name()) {
+			os.RemoveAll(filepath.Join(tgtf, file.Name()))
+		}
+	}
+	files, err = ioutil.ReadDir(filepath.Join(tgtf, "lib"))
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		path := filepath.Join(tgtf, "lib", file.Name())
+		if file.IsDir() {
+			if !zstdDirs[file.Name()] {
+				os.RemoveAll(path)
+			}
+			continue
+		}
+		if filepath.Ext(file.Name()) != ".h" {
+			os.Remove(path)
+		}
+	}
+	sources := make(map[string][]string)
+	for dir := range zstdDirs {
+		files, err := ioutil.ReadDir(filepath.Join(tgtf, "lib", dir))
+		if err != nil {
+			return "", "", err
+		}
+		for _, file := range files {
+			path := filepath.Join(tgtf, "lib", dir, file.Name())
+			if file.IsDir() {
+				os.RemoveAll(path)
+				continue
+			}
+			switch filepath.Ext(file.Name()) {
+			case ".c":
+				sources[dir] = append(sources[dir], strings.TrimSuffix(file.Name(), ".c"))
+			case ".h":
+			default:
+				// Drop the assembly (e.g. Huffman decoding), keep the build portable
+				os.Remove(path)
+			}
+		}
 	}
-	// Copy in the library preamble with the architecture definitions
-	if err := os.MkdirAll("libtor", 0755); err != nil {
-		panic(err)
+	// Ensure the remaining sources are the ones locked
+	if err := checkTree("zstd", tgtf, tracked, lock); err != nil {
+		return "", "", err
 	}
-	blob, _ := ioutil.ReadFile(filepath.Join("build", "libtor_preamble.go.in"))
-	ioutil.WriteFile(filepath.Join("libtor", "libtor_preamble.go"), blob, 0644)
 
-	// Create target directory
-	if err := os.MkdirAll(tgt, 0755); err != nil {
-		panic(err)
-	}
+	// TarGeTFILTer
+	tgtFilt := targetFilters[tgt]
 
-	// Wrap each of the component libraries into megator
-	zlibVer, zlibHash, err := wrapZlib(tgt, lock)
+	// Generate Go wrappers for each C source individually
+	tmpl, err := template.New("").Parse(zstdTemplate)
 	if err != nil {
-		panic(err)
+		return "", "", err
 	}
-	libeventVer, libeventHash, err := wrapLibevent(tgt, lock)
-	if err != nil {
-		panic(err)
+	for dir, names := range sources {
+		for _, name := range names {
+			buff := new(bytes.Buffer)
+			if err := tmpl.Execute(buff, map[string]string{
+				"TargetFilter": tgtFilt,
+				"Dir":          dir,
+				"File":         name,
+			}); err != nil {
+				return "", "", err
+			}
+			writeWrapper("zstd", "lib/"+dir+"/"+name+".c", filepath.Join("libtor", tgt+"_zstd_"+dir+"_"+name+".go"), buff.Bytes())
+		}
 	}
-	opensslVer, opensslHash, err := wrapOpenSSL(tgt, lock)
+
+	tmpl, err = template.New("").Parse(zstdPreamble)
 	if err != nil {
-		panic(err)
+		return "", "", err
 	}
-	torVer, torHash, err := wrapTor(tgt, lock)
-	if err != nil {
-		panic(err)
+	buff := new(bytes.Buffer)
+	if err := tmpl.Execute(buff, map[string]string{
+		"TargetFilter": tgtFilt,
+		"Target":       tgt,
+		"Version":      strver,
+	}); err != nil {
+		return "", "", err
 	}
+	writeOutput(filepath.Join("libtor", tgt+"_zstd_preamble.go"), buff.Bytes())
+	return strver, string(commit), nil
+}
 
-	// Copy and fill out the libtor entrypoint wrappers and the readme template.
-	blob, _ = ioutil.ReadFile(filepath.Join("build", "libtor_external.go.in"))
-	ioutil.WriteFile(filepath.Join("libtor.go"), blob, 0644)
-	blob, _ = ioutil.ReadFile(filepath.Join("build", "libtor_internal.go.in"))
-	ioutil.WriteFile(filepath.Join("libtor", "libtor.go"), blob, 0644)
+// zstdPreamble is the CGO preamble injected to configure the C compiler. Besides
+// the zstd build options, it defines LIBTOR_ZSTD, which enables zstd support in
+// the Tor configuration headers.
+var zstdPreamble = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
 
-	if !*nobuild {
-		builder := exec.Command("go", "build", ".")
-		builder.Stdout = os.Stdout
-		builder.Stderr = os.Stderr
+package libtor
 
-		if err := builder.Run(); err != nil {
-			panic(err)
-		}
-	}
+/*
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/zstd/lib
+#cgo CFLAGS: -DZSTD_DISABLE_ASM -DZSTD_LEGACY_SUPPORT=0 -DZSTD_TRACE=0 -DXXH_NAMESPACE=ZSTD_
+#cgo CFLAGS: -DLIBTOR_ZSTD
+*/
+import "C"
 
-	// Update
-	if *genLock {
-		tmpl := template.Must(template.ParseFiles(filepath.Join("build", "README.md")))
-		buf := new(bytes.Buffer)
-		tmpl.Execute(buf, map[string]string{
-			"zlibVer":      zlibVer,
-			"zlibHash":     zlibHash,
-			"libeventVer":  libeventVer,
-			"libeventHash": libeventHash,
-			"opensslVer":   opensslVer,
-			"opensslHash":  opensslHash,
-			"torVer":       torVer,
-			"torHash":      torHash,
-		})
-		ioutil.WriteFile("README.md", buf.Bytes(), 0644)
-		buff, err := json.MarshalIndent(lockJson{
-			Zlib:     zlibHash,
-			Libevent: libeventHash,
-			Openssl:  opensslHash,
-			Tor:      torHash,
-		}, "", "  ")
-		if err != nil {
-			panic(err)
-		}
-		buff = append(buff, '\n')
-		ioutil.WriteFile("lock.json", buff, 0644)
-	}
+func init() {
+	wrappedVersions["zstd"] = "{{.Version}}"
 }
+`
 
-// targetFilters maps a build target to the builds tags to apply to it
-var targetFilters = map[string]string{
-	"linux":  "linux android",
-	"darwin": "darwin,amd64 darwin,arm64 ios,amd64 ios,arm64",
-}
+// zstdTemplate is the source file template used in zstd Go wrappers.
+var zstdTemplate = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
 
-// lockJson stores the commits for later reuse.
-type lockJson struct {
-	Zlib     string `json:"zlib"`
-	Libevent string `json:"libevent"`
-	Openssl  string `json:"openssl"`
-	Tor      string `json:"tor"`
-}
+package libtor
 
-// wrapZlib clones the zlib library into the local repository and wraps it into
-// a Go package.
+/*
+#include <../lib/{{.Dir}}/{{.File}}.c>
+*/
+import "C"
+`
+
+// wrapLzma clones the xz library into the local repository and wraps liblzma
+// into a Go package.
 //
-// Zlib is a small and simple C library which can be wrapped by inserting an empty
-// Go file among the C sources, causing the Go compiler to pick up all the loose
-// sources and build them together into a static library.
-func wrapZlib(tgt string, lock *lockJson) (string, string, error) {
+// Liblzma relies on autoconf and makefiles to select the sources of the enabled
+// filters and integrity checks, so similarly to libevent, the build is hooked to
+// gather them. Only the LZMA1/2 codecs and the integrity checks used by the xz
+// format are enabled, without threading or assembly, so instead of maintaining
+// configuration headers, the few feature flags are set from the preamble.
+func wrapLzma(tgt string, lock *lockJson) (string, string, error) {
 	// TarGeT Full
-	tgtf := filepath.Join(tgt, "zlib")
-
-	cloner := exec.Command("git", "clone", "https://github.com/madler/zlib")
-	cloner.Stdout = os.Stdout
-	cloner.Stderr = os.Stderr
-	cloner.Dir = tgt
-
-	if err := cloner.Run(); err != nil {
-		return "", "", err
-	}
+	tgtf := filepath.Join(tgt, "lzma")
 
-	// If we have a commit lock, checkout these commits.
+	// If we have a commit lock, checkout these commits, otherwise the latest
+	// stable branch. A lock taken without --with-lzma can't pin it, so refuse to
+	// silently wrap whatever is current.
+	var lockCommit string
 	if lock != nil {
-		checkouter := exec.Command("git", "checkout", lock.Zlib)
-		checkouter.Dir = tgtf
-
-		if err := checkouter.Run(); err != nil {
-			return "", "", err
+		if lock.Lzma == "" {
+			return "", "", fmt.Errorf("no lzma commit in lock file for target %s, lock one with --update --with-lzma", tgt)
 		}
+		lockCommit = lock.Lzma
+	}
+	if err := fetchRepo("lzma", []string{"https://github.com/tukaani-project/xz"}, tgtf, lzmaBranch, lockCommit); err != nil {
+		return "", "", err
 	}
 
 	// Save the latest upstream commit hash for later reference
@@ -186,55 +2294,106 @@ func wrapZlib(tgt string, lock *lockJson) (string, string, error) {
 	commit, err := parser.CombinedOutput()
 	if err != nil {
 		fmt.Println(string(commit))
-		return "", "", err
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
 	}
 	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
+
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
+		return "", "", err
+	}
 
 	// Retrieve the version of the current commit
-	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "zlib.h"))
-	strver := regexp.MustCompile("define ZLIB_VERSION \"(.+)\"").FindSubmatch(conf)[1]
+	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "src", "liblzma", "api", "lzma", "version.h"))
 
-	// Wipe everything from the library that's non-essential
+	var parts []string
+	for _, part := range []string{"MAJOR", "MINOR", "PATCH"} {
+		ver, err := extractVersion(conf, "define LZMA_VERSION_"+part+"\\s+([0-9]+)")
+		if err != nil {
+			return "", "", err
+		}
+		parts = append(parts, string(ver))
+	}
+	strver := strings.Join(parts, ".")
+
+	// Gather the needed sources, either from the make system or a previous run
+	var deps [][]string
+	if *noConfigure {
+		if deps, err = recordedSources("lzma", "src/liblzma"); err != nil {
+			return "", "", err
+		}
+	} else {
+		out, err := configureLzma(tgtf)
+		if err != nil {
+			return "", "", err
+		}
+		deps = uniqueSources(regexp.MustCompile("[ '`]((?:\\.\\./)?[a-z0-9_]+/[a-z0-9_]+)\\.c\\b").FindAllStringSubmatch(string(out), -1))
+	}
+	if err := checkSources("lzma", deps); err != nil {
+		return "", "", err
+	}
+
+	// Wipe everything from the library that's non-essential, keeping only the
+	// liblzma sources, the shared helpers from src/common and the license
 	files, err := ioutil.ReadDir(tgtf)
 	if err != nil {
 		return "", "", err
 	}
 	for _, file := range files {
-		if file.IsDir() {
+		if file.Name() != "src" && file.Name() != "COPYING" && !keepClone(file.Name()) {
 			os.RemoveAll(filepath.Join(tgtf, file.Name()))
-			continue
 		}
-		if ext := filepath.Ext(file.Name()); ext != ".h" && ext != ".c" {
-			os.Remove(filepath.Join(tgtf, file.Name()))
+	}
+	files, err = ioutil.ReadDir(filepath.Join(tgtf, "src"))
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		if file.Name() != "liblzma" && file.Name() != "common" {
+			os.RemoveAll(filepath.Join(tgtf, "src", file.Name()))
+		}
+	}
+	err = filepath.Walk(filepath.Join(tgtf, "src"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); !info.IsDir() && ext != ".h" && ext != ".c" {
+			return os.Remove(path)
 		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	// Ensure the remaining sources are the ones locked
+	if err := checkTree("lzma", tgtf, tracked, lock); err != nil {
+		return "", "", err
 	}
 
 	// TarGeTFILTer
 	tgtFilt := targetFilters[tgt]
 
 	// Generate Go wrappers for each C source individually
-	tmpl, err := template.New("").Parse(zlibTemplate)
+	tmpl, err := template.New("").Parse(lzmaTemplate)
 	if err != nil {
 		return "", "", err
 	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		if ext := filepath.Ext(file.Name()); ext == ".c" {
-			name := strings.TrimSuffix(file.Name(), ext)
-			buff := new(bytes.Buffer)
-			if err := tmpl.Execute(buff, map[string]string{
-				"TargetFilter": tgtFilt,
-				"File":         name,
-			}); err != nil {
-				return "", "", err
-			}
-			ioutil.WriteFile(filepath.Join("libtor", tgt+"_zlib_"+name+".go"), buff.Bytes(), 0644)
+	for _, dep := range deps {
+		buff := new(bytes.Buffer)
+		if err := tmpl.Execute(buff, map[string]string{
+			"TargetFilter": tgtFilt,
+			"File":         dep[1],
+		}); err != nil {
+			return "", "", err
 		}
+		name := strings.Replace(strings.TrimPrefix(dep[1], "../"), "/", "_", -1)
+		writeWrapper("lzma", path.Join("src/liblzma", dep[1])+".c", filepath.Join("libtor", tgt+"_lzma_"+name+".go"), buff.Bytes())
 	}
-
-	tmpl, err = template.New("").Parse(zlibPreamble)
+	tmpl, err = template.New("").Parse(lzmaPreamble)
 	if err != nil {
 		return "", "", err
 	}
@@ -242,37 +2401,102 @@ func wrapZlib(tgt string, lock *lockJson) (string, string, error) {
 	if err := tmpl.Execute(buff, map[string]string{
 		"TargetFilter": tgtFilt,
 		"Target":       tgt,
+		"Version":      strver,
 	}); err != nil {
 		return "", "", err
 	}
-	ioutil.WriteFile(filepath.Join("libtor", tgt+"_zlib_preamble.go"), buff.Bytes(), 0644)
-	return string(strver), string(commit), nil
+	writeOutput(filepath.Join("libtor", tgt+"_lzma_preamble.go"), buff.Bytes())
+	return strver, string(commit), nil
 }
 
-// zlibPreamble is the CGO preamble injected to configure the C compiler.
-var zlibPreamble = `// go-libtor - Self-contained Tor from Go
+// lzmaBranch is the xz stable branch wrapped when not pinned via the lock file.
+const lzmaBranch = "v5.8"
+
+// configureLzma configures the liblzma library for compilation, with only the
+// features needed by Tor, and returns the output of a make dry run listing all
+// the compilation steps.
+func configureLzma(tgtf string) ([]byte, error) {
+	defer stage("lzma", "configure")()
+
+	autogen := exec.Command("./autogen.sh", "--no-po4a", "--no-doxygen")
+	autogen.Dir = tgtf
+	autogen.Stdout = os.Stdout
+	autogen.Stderr = os.Stderr
+
+	if err := autogen.Run(); err != nil {
+		return nil, fmt.Errorf("autogen failed: %v", err)
+	}
+	configure := exec.Command("./configure",
+		"--disable-shared", "--enable-static", "--disable-threads", "--disable-assembler",
+		"--disable-xz", "--disable-xzdec", "--disable-lzmadec", "--disable-lzmainfo",
+		"--disable-lzma-links", "--disable-scripts", "--disable-doc", "--disable-nls",
+		"--disable-lzip-decoder", "--disable-microlzma", "--disable-ifunc",
+		"--disable-clmul-crc", "--disable-arm64-crc32",
+		"--enable-encoders=lzma1,lzma2", "--enable-decoders=lzma1,lzma2",
+		"--enable-checks=crc32,crc64,sha256",
+	)
+	configure.Dir = tgtf
+	configure.Stdout = os.Stdout
+	configure.Stderr = os.Stderr
+
+	if err := configure.Run(); err != nil {
+		return nil, fmt.Errorf("configure failed: %v", err)
+	}
+	// Hook the make system and gather the needed sources
+	maker := exec.Command(makeTool(), "--dry-run", "liblzma.la")
+	maker.Dir = filepath.Join(tgtf, "src", "liblzma")
+
+	out, err := maker.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(out))
+		return nil, fmt.Errorf("make dry run failed: %v", err)
+	}
+	return out, nil
+}
+
+// lzmaPreamble is the CGO preamble injected to configure the C compiler. The
+// feature flags must match the configure options in wrapLzma. It also defines
+// LIBTOR_LZMA, which enables LZMA support in the Tor configuration headers.
+var lzmaPreamble = `// go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
 // +build {{.TargetFilter}}
 
 package libtor
 
-
 /*
-#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/zlib
-#cgo CFLAGS: -DHAVE_UNISTD_H -DHAVE_STDARG_H
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/common
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/api
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/check
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/common
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/delta
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/lz
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/lzma
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/rangecoder
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/lzma/src/liblzma/simple
+#cgo CFLAGS: -DLZMA_API_STATIC -DTUKLIB_SYMBOL_PREFIX=lzma_ -DHAVE_VISIBILITY=0
+#cgo CFLAGS: -DHAVE_STDBOOL_H -DHAVE_STDINT_H -DHAVE_INTTYPES_H
+#cgo CFLAGS: -DHAVE_ENCODERS -DHAVE_ENCODER_LZMA1 -DHAVE_ENCODER_LZMA2
+#cgo CFLAGS: -DHAVE_DECODERS -DHAVE_DECODER_LZMA1 -DHAVE_DECODER_LZMA2
+#cgo CFLAGS: -DHAVE_MF_HC3 -DHAVE_MF_HC4 -DHAVE_MF_BT2 -DHAVE_MF_BT3 -DHAVE_MF_BT4
+#cgo CFLAGS: -DHAVE_CHECK_CRC32 -DHAVE_CHECK_CRC64 -DHAVE_CHECK_SHA256
+#cgo CFLAGS: -DLIBTOR_LZMA
 */
 import "C"
+
+func init() {
+	wrappedVersions["lzma"] = "{{.Version}}"
+}
 `
 
-// zlibTemplate is the source file template used in zlib Go wrappers.
-var zlibTemplate = `// go-libtor - Self-contained Tor from Go
+// lzmaTemplate is the source file template used in liblzma Go wrappers.
+var lzmaTemplate = `// go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
 // +build {{.TargetFilter}}
 
 package libtor
 
 /*
-#include <../zlib/{{.File}}.c>
+#include <../{{.File}}.c>
 */
 import "C"
 `
@@ -292,24 +2516,21 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 	// TarGeT Full
 	tgtf := filepath.Join(tgt, "libevent")
 
-	cloner := exec.Command("git", "clone", "https://github.com/libevent/libevent")
-	cloner.Stdout = os.Stdout
-	cloner.Stderr = os.Stderr
-	cloner.Dir = tgt
-
-	if err := cloner.Run(); err != nil {
-		return "", "", err
-	}
-
-	// If we have a commit lock, checkout these commits.
+	// If we have a commit lock, checkout these commits, unless a specific ref was
+	// requested, which is either a full commit hash or a branch or tag name.
+	var branch, lockCommit string
 	if lock != nil {
-		checkouter := exec.Command("git", "checkout", lock.Libevent)
-		checkouter.Dir = tgtf
-
-		if err := checkouter.Run(); err != nil {
-			return "", "", err
+		lockCommit = lock.Libevent
+	}
+	if *libeventRef != "" {
+		branch, lockCommit = *libeventRef, ""
+		if commitRegexp.MatchString(*libeventRef) {
+			branch, lockCommit = "", *libeventRef
 		}
 	}
+	if err := fetchRepo("libevent", []string{"https://github.com/libevent/libevent"}, tgtf, branch, lockCommit); err != nil {
+		return "", "", err
+	}
 
 	// Save the latest upstream commit hash for later reference
 	parser := exec.Command("git", "rev-parse", "HEAD")
@@ -318,42 +2539,45 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 	commit, err := parser.CombinedOutput()
 	if err != nil {
 		fmt.Println(string(commit))
-		return "", "", err
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
 	}
 	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
 
-	// Configure the library for compilation
-	autogen := exec.Command("./autogen.sh")
-	autogen.Dir = tgtf
-	autogen.Stdout = os.Stdout
-	autogen.Stderr = os.Stderr
-
-	if err := autogen.Run(); err != nil {
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
 		return "", "", err
 	}
-	configure := exec.Command("./configure", "--disable-shared", "--enable-static")
-	configure.Dir = tgtf
-	configure.Stdout = os.Stdout
-	configure.Stderr = os.Stderr
 
-	if err := configure.Run(); err != nil {
+	// Retrieve the version of the current commit (hex, e.g. 0x02010c00 for 2.1.12)
+	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "configure.ac"))
+	numver, err := extractVersion(conf, "AC_DEFINE\\(NUMERIC_VERSION, (0x[0-9a-fA-F]{8}),")
+	if err != nil {
 		return "", "", err
 	}
-	// Retrieve the version of the current commit
-	conf, _ := ioutil.ReadFile(filepath.Join(tgtf, "configure.ac"))
-	numver := regexp.MustCompile("AC_DEFINE\\(NUMERIC_VERSION, (0x[0-9]{8}),").FindSubmatch(conf)[1]
-	strver := regexp.MustCompile("AC_INIT\\(libevent,(.+)\\)").FindSubmatch(conf)[1]
-
-	// Hook the make system and gather the needed sources
-	maker := exec.Command("make", "--dry-run", "libevent.la")
-	maker.Dir = tgtf
-
-	out, err := maker.CombinedOutput()
+	strver, err := extractVersion(conf, "AC_INIT\\(libevent,(.+)\\)")
 	if err != nil {
-		fmt.Println(string(out))
 		return "", "", err
 	}
-	deps := regexp.MustCompile(" ([a-z_]+)\\.lo;").FindAllStringSubmatch(string(out), -1)
+	// Gather the needed sources, either from the make system or a previous run
+	var deps [][]string
+	if *noConfigure {
+		if deps, err = recordedSources("libevent", ""); err != nil {
+			return "", "", err
+		}
+	} else {
+		out, err := configureLibevent(tgtf)
+		if err != nil {
+			return "", "", err
+		}
+		deps = uniqueSources(regexp.MustCompile(" ([a-z_]+)\\.lo;").FindAllStringSubmatch(string(out), -1))
+	}
+	if err := checkSources("libevent", deps); err != nil {
+		return "", "", err
+	}
 
 	// Wipe everything from the library that's non-essential
 	files, err := ioutil.ReadDir(tgtf)
@@ -363,7 +2587,7 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 	for _, file := range files {
 		// Remove all folders apart from the headers
 		if file.IsDir() {
-			if file.Name() == "include" || file.Name() == "compat" {
+			if file.Name() == "include" || file.Name() == "compat" || keepClone(file.Name()) {
 				continue
 			}
 			os.RemoveAll(filepath.Join(tgtf, file.Name()))
@@ -377,6 +2601,14 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 			os.Remove(filepath.Join(tgtf, file.Name()))
 		}
 	}
+	// Ensure the remaining sources are the ones locked, unless overridden
+	verify := lock
+	if *libeventRef != "" {
+		verify = nil
+	}
+	if err := checkTree("libevent", tgtf, tracked, verify); err != nil {
+		return "", "", err
+	}
 
 	// TarGeTFILTer
 	tgtFilt := targetFilters[tgt]
@@ -394,7 +2626,7 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 		}); err != nil {
 			return "", "", err
 		}
-		ioutil.WriteFile(filepath.Join("libtor", tgt+"_libevent_"+dep[1]+".go"), buff.Bytes(), 0644)
+		writeWrapper("libevent", dep[1]+".c", filepath.Join("libtor", tgt+"_libevent_"+dep[1]+".go"), buff.Bytes())
 	}
 	tmpl, err = template.New("").Parse(libeventPreamble)
 	if err != nil {
@@ -404,15 +2636,16 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 	if err := tmpl.Execute(buff, map[string]string{
 		"TargetFilter": tgtFilt,
 		"Target":       tgt,
+		"Version":      string(strver),
 	}); err != nil {
 		return "", "", err
 	}
-	ioutil.WriteFile(filepath.Join("libtor", tgt+"_libevent_preamble.go"), buff.Bytes(), 0644)
+	writeOutput(filepath.Join("libtor", tgt+"_libevent_preamble.go"), buff.Bytes())
 
 	// Inject the configuration headers and ensure everything builds
 	os.MkdirAll(filepath.Join("libevent_config", "event2"), 0755)
 
-	for _, arch := range []string{"", ".linux64", ".linux32", ".android64", ".android32", ".macos64", ".ios64"} {
+	for _, arch := range libeventConfigs {
 		blob, _ := ioutil.ReadFile(filepath.Join("config", "libevent", fmt.Sprintf("event-config%s.h", arch)))
 		tmpl, err := template.New("").Parse(string(blob))
 		if err != nil {
@@ -422,11 +2655,44 @@ func wrapLibevent(tgt string, lock *lockJson) (string, string, error) {
 		if err := tmpl.Execute(buff, struct{ NumVer, StrVer string }{string(numver), string(strver)}); err != nil {
 			return "", "", err
 		}
-		ioutil.WriteFile(filepath.Join("libevent_config", "event2", fmt.Sprintf("event-config%s.h", arch)), buff.Bytes(), 0644)
+		writeOutput(filepath.Join("libevent_config", "event2", fmt.Sprintf("event-config%s.h", arch)), buff.Bytes())
 	}
 	return string(strver), string(commit), nil
 }
 
+// configureLibevent configures the libevent library for compilation and returns
+// the output of a make dry run listing all the compilation steps.
+func configureLibevent(tgtf string) ([]byte, error) {
+	defer stage("libevent", "configure")()
+
+	autogen := exec.Command("./autogen.sh")
+	autogen.Dir = tgtf
+	autogen.Stdout = os.Stdout
+	autogen.Stderr = os.Stderr
+
+	if err := autogen.Run(); err != nil {
+		return nil, fmt.Errorf("autogen failed: %v", err)
+	}
+	configure := exec.Command("./configure", "--disable-shared", "--enable-static")
+	configure.Dir = tgtf
+	configure.Stdout = os.Stdout
+	configure.Stderr = os.Stderr
+
+	if err := configure.Run(); err != nil {
+		return nil, fmt.Errorf("configure failed: %v", err)
+	}
+	// Hook the make system and gather the needed sources
+	maker := exec.Command(makeTool(), "--dry-run", "libevent.la")
+	maker.Dir = tgtf
+
+	out, err := maker.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(out))
+		return nil, fmt.Errorf("make dry run failed: %v", err)
+	}
+	return out, nil
+}
+
 // libeventPreamble is the CGO preamble injected to configure the C compiler.
 var libeventPreamble = `// go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
@@ -441,6 +2707,10 @@ package libtor
 #cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/libevent/include
 */
 import "C"
+
+func init() {
+	wrappedVersions["libevent"] = "{{.Version}}"
+}
 `
 
 // libeventTemplate is the source file template used in libevent Go wrappers.
@@ -475,39 +2745,57 @@ func wrapOpenSSL(tgt string, lock *lockJson) (string, string, error) {
 	// TarGeT Full
 	tgtf := filepath.Join(tgt, "openssl")
 
-	cloner := exec.Command("git", "clone", "https://github.com/openssl/openssl")
-	cloner.Stdout = os.Stdout
-	cloner.Stderr = os.Stderr
-	cloner.Dir = tgt
-
-	if err := cloner.Run(); err != nil {
-		return "", "", err
-	}
-
-	// OpenSSL is a security concern, switch to the latest stable code
-	brancher := exec.Command("git", "branch", "-a")
-	brancher.Dir = tgtf
-
-	out, err := brancher.CombinedOutput()
-	if err != nil {
-		return "", "", err
-	}
-	stables := regexp.MustCompile("remotes/origin/(OpenSSL_[0-9]_[0-9]_[0-9]-stable)").FindAllSubmatch(out, -1)
-	if len(stables) == 0 {
-		return "", "", errors.New("no stable branch found")
-	}
-	var checkout string
-	// If we have a commit lock, checkout these commits.
+	repo := defaultOpenSSLRepo
+	if *opensslRepo != "" {
+		repo = *opensslRepo
+	}
+	// If we have a commit lock, checkout these commits, unless a specific ref was
+	// requested, which is either a full commit hash or a branch or tag name.
+	var (
+		branch     string
+		lockCommit string
+		out        []byte
+		err        error
+	)
 	if lock != nil {
-		checkout = lock.Openssl
-	} else {
-		checkout = string(stables[len(stables)-1][1])
+		lockCommit = lock.Openssl
 	}
-	switcher := exec.Command("git", "checkout", checkout)
-	switcher.Dir = tgtf
+	if *opensslRef != "" {
+		branch, lockCommit = *opensslRef, ""
+		if commitRegexp.MatchString(*opensslRef) {
+			branch, lockCommit = "", *opensslRef
+		}
+	} else {
+		// OpenSSL is a security concern, switch to the latest stable code. List the
+		// remote branches to find it, without having to clone all of them. Offline,
+		// use the listing saved when the sources were fetched.
+		listing := filepath.Join(*sourcesDir, "openssl.branches")
+
+		if *sourcesDir != "" && !*fetchOnly {
+			if out, err = ioutil.ReadFile(listing); err != nil {
+				return "", "", fmt.Errorf("branch listing failed: %v", err)
+			}
+		} else {
+			brancher := exec.Command("git", "ls-remote", "--heads", repo)
 
-	if out, err = switcher.CombinedOutput(); err != nil {
-		fmt.Println(string(out))
+			if out, err = brancher.CombinedOutput(); err != nil {
+				fmt.Println(string(out))
+				return "", "", fmt.Errorf("branch listing failed: %v", err)
+			}
+			if *fetchOnly {
+				if err := ioutil.WriteFile(listing, out, 0644); err != nil {
+					return "", "", err
+				}
+			}
+		}
+		if branch, err = latestOpenSSLBranch(out); err != nil {
+			if *opensslRepo != "" {
+				return "", "", fmt.Errorf("%v, pick one with --openssl-ref", err)
+			}
+			return "", "", err
+		}
+	}
+	if err := fetchRepo("openssl", []string{repo}, tgtf, branch, lockCommit); err != nil {
 		return "", "", err
 	}
 	// Save the latest upstream commit hash for later reference
@@ -517,9 +2805,18 @@ func wrapOpenSSL(tgt string, lock *lockJson) (string, string, error) {
 	commit, err := parser.CombinedOutput()
 	if err != nil {
 		fmt.Println(string(commit))
-		return "", "", err
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
 	}
 	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
+
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
+		return "", "", err
+	}
 
 	//Save the latest
 	timer := exec.Command("git", "show", "-s", "--format=%cd")
@@ -528,135 +2825,553 @@ func wrapOpenSSL(tgt string, lock *lockJson) (string, string, error) {
 	date, err := timer.CombinedOutput()
 	if err != nil {
 		fmt.Println(string(date))
+		return "", "", fmt.Errorf("commit date lookup failed: %v", err)
+	}
+	date = bytes.TrimSpace(date)
+
+	// Extract the version string and figure out which flavor of the library this is
+	strver, flavor, err := detectOpenSSL(tgtf, branch)
+	if err != nil {
+		return "", "", err
+	}
+	if flavor == opensslFlavorLibreSSL {
+		return "", "", fmt.Errorf("LibreSSL %s uses an autotools build which can't be wrapped yet, only forks keeping OpenSSL's Configure can", strver)
+	}
+	modern := flavor == opensslFlavorModern
+
+	// Configure the library for compilation and gather the needed sources
+	if out, err = configureOpenSSL(tgtf, modern, false); err != nil {
+		return "", "", err
+	}
+	// OpenSSL 3.x may list the same source for multiple internal libraries (e.g.
+	// libcrypto and libdefault), but it's enough to wrap each once.
+	deps := uniqueSources(regexp.MustCompile("(?m)([a-z0-9_/-]+)\\.c$").FindAllStringSubmatch(string(out), -1))
+	if err := checkSources("openssl", deps); err != nil {
+		return "", "", err
+	}
+	// If assembly was requested, reconfigure the library with it enabled and look
+	// for the differences compared to the portable build
+	var asmSrcs *opensslAsmSources
+	if *asm != "" {
+		asmOut, err := configureOpenSSL(tgtf, modern, true)
+		if err != nil {
+			return "", "", err
+		}
+		if asmSrcs, err = diffOpenSSLAsm(tgtf, deps, out, asmOut); err != nil {
+			return "", "", err
+		}
+	}
+	// Wipe everything from the library that's non-essential
+	files, err := ioutil.ReadDir(tgtf)
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		// Remove all folders apart from the headers
+		if file.IsDir() {
+			if file.Name() == "crypto" || file.Name() == "engines" || file.Name() == "include" || file.Name() == "ssl" {
+				continue
+			}
+			if modern && file.Name() == "providers" {
+				continue
+			}
+			if keepClone(file.Name()) {
+				continue
+			}
+			os.RemoveAll(filepath.Join(tgtf, file.Name()))
+			continue
+		}
+		// Remove all files apart from the license and sources
+		if file.Name() == "LICENSE" || file.Name() == "LICENSE.txt" {
+			continue
+		}
+		if ext := filepath.Ext(file.Name()); ext != ".h" && ext != ".c" {
+			os.Remove(filepath.Join(tgtf, file.Name()))
+		}
+	}
+	// Ensure the remaining sources are the ones locked, unless overridden
+	verify := lock
+	if *opensslRef != "" {
+		verify = nil
+	}
+	if err := checkTree("openssl", tgtf, tracked, verify); err != nil {
+		return "", "", err
+	}
+
+	// TarGeTFILTer
+	tgtFilt := targetFilters[tgt]
+
+	// Generate Go wrappers for each C source individually
+	tmpl, err := template.New("").Parse(opensslTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	for _, dep := range deps {
+		// Skip any files not needed for the library
+		if strings.HasPrefix(dep[1], "apps/") {
+			continue
+		}
+		if strings.HasPrefix(dep[1], "fuzz/") {
+			continue
+		}
+		if strings.HasPrefix(dep[1], "test/") {
+			continue
+		}
+		// Sources replaced by assembly are only needed on the other architectures
+		filter := tgtFilt
+		if asmSrcs != nil && asmSrcs.Generic[dep[1]] {
+			filter = archFilter(tgt, *asm, false)
+		}
+		// Anything else is wrapped directly with Go
+		gofile := strings.Replace(dep[1], "/", "_", -1) + ".go"
+		buff := new(bytes.Buffer)
+		if err := tmpl.Execute(buff, map[string]interface{}{
+			"TargetFilter": filter,
+			"File":         dep[1],
+			"Modern":       modern,
+		}); err != nil {
+			return "", "", err
+		}
+		writeWrapper("openssl", dep[1]+".c", filepath.Join("libtor", tgt+"_openssl_"+gofile), buff.Bytes())
+	}
+	if asmSrcs != nil {
+		if err := wrapOpenSSLAsm(tgt, modern, asmSrcs); err != nil {
+			return "", "", err
+		}
+	}
+	// The config headers are shared, so disable the dropped algorithms from the
+	// preamble (the CFLAGS apply to the whole package, Tor included)
+	var disabled []string
+	if *minimalOpenSSL {
+		for _, alg := range opensslUnused {
+			disabled = append(disabled, strings.ToUpper(alg))
+		}
+	}
+	tmpl, err = template.New("").Parse(opensslPreamble)
+	if err != nil {
+		return "", "", err
+	}
+	buff := new(bytes.Buffer)
+	if err := tmpl.Execute(buff, map[string]interface{}{
+		"TargetFilter": tgtFilt,
+		"Target":       tgt,
+		"Version":      string(strver),
+		"Modern":       modern,
+		"Disabled":     disabled,
+	}); err != nil {
+		return "", "", err
+	}
+	writeOutput(filepath.Join("libtor", tgt+"_openssl_preamble.go"), buff.Bytes())
+
+	// Emit the alternate preamble linking the system OpenSSL instead
+	tmpl, err = template.New("").Parse(opensslSystemPreamble)
+	if err != nil {
+		return "", "", err
+	}
+	buff = new(bytes.Buffer)
+	if err := tmpl.Execute(buff, map[string]string{
+		"TargetFilter": tgtFilt,
+	}); err != nil {
 		return "", "", err
 	}
-	date = bytes.TrimSpace(date)
-
-	// Extract the version string
-	strver := bytes.Replace(stables[len(stables)-1][1], []byte("_"), []byte("."), -1)[len("OpenSSL_"):]
-
-	// Configure the library for compilation
-	config := exec.Command("./config", "no-shared", "no-zlib", "no-asm", "no-async", "no-sctp")
-	config.Dir = tgtf
-	config.Stdout = os.Stdout
-	config.Stderr = os.Stderr
+	writeOutput(filepath.Join("libtor", tgt+"_openssl_system.go"), buff.Bytes())
+
+	// Inject the configuration headers and ensure everything builds
+	os.MkdirAll(filepath.Join("openssl_config", "crypto"), 0755)
+
+	for _, arch := range opensslDsoConfigs {
+		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("dso_conf%s.h", arch)))
+		writeOutput(filepath.Join("openssl_config", "crypto", fmt.Sprintf("dso_conf%s.h", arch)), blob)
+	}
+
+	for _, arch := range opensslBnConfigs {
+		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("bn_conf%s.h", arch)))
+		writeOutput(filepath.Join("openssl_config", "crypto", fmt.Sprintf("bn_conf%s.h", arch)), blob)
+	}
+	for _, arch := range opensslInfConfigs {
+		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("buildinf%s.h", arch)))
+		tmpl, err := template.New("").Parse(string(blob))
+		if err != nil {
+			return "", "", err
+		}
+		buff := new(bytes.Buffer)
+		if err := tmpl.Execute(buff, struct{ Date string }{string(date)}); err != nil {
+			return "", "", err
+		}
+		writeOutput(filepath.Join("openssl_config", fmt.Sprintf("buildinf%s.h", arch)), buff.Bytes())
+	}
+	// The public configuration header moved from opensslconf.h to configuration.h
+	// in OpenSSL 3.x, the former only including the latter. Drop any stale ones
+	// not to shadow the upstream headers.
+	os.RemoveAll(filepath.Join("openssl_config", "openssl"))
+	os.MkdirAll(filepath.Join("openssl_config", "openssl"), 0755)
+
+	for _, arch := range opensslConfigs {
+		if modern {
+			blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl3", fmt.Sprintf("configuration%s.h", arch)))
+			writeOutput(filepath.Join("openssl_config", "openssl", fmt.Sprintf("configuration%s.h", arch)), blob)
+			continue
+		}
+		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("opensslconf%s.h", arch)))
+		writeOutput(filepath.Join("openssl_config", "openssl", fmt.Sprintf("opensslconf%s.h", arch)), blob)
+	}
+	return string(strver), string(commit), nil
+}
+
+// homebrewOpenSSL picks the newest OpenSSL keg installed by Homebrew under the
+// given prefix. Each major version lives in its own keg (openssl@1.1, openssl@3)
+// and the default moves along with upstream, so none of them can be assumed.
+func homebrewOpenSSL(prefix string) (string, error) {
+	kegs, err := filepath.Glob(filepath.Join(prefix, "opt", "openssl@*"))
+	if err != nil {
+		return "", err
+	}
+	var (
+		latest  string
+		version []int
+	)
+	for _, keg := range kegs {
+		var parsed []int
+		for _, field := range strings.Split(strings.SplitN(filepath.Base(keg), "@", 2)[1], ".") {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				parsed = nil
+				break
+			}
+			parsed = append(parsed, n)
+		}
+		if parsed == nil {
+			continue
+		}
+		newer := latest == ""
+		for i := 0; !newer && i < len(parsed); i++ {
+			if i >= len(version) || parsed[i] > version[i] {
+				newer = true
+			} else if parsed[i] < version[i] {
+				break
+			}
+		}
+		if newer {
+			latest, version = keg, parsed
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no Homebrew OpenSSL found in %s, install one with `brew install openssl@3`", filepath.Join(prefix, "opt"))
+	}
+	return latest, nil
+}
+
+// defaultOpenSSLRepo is the repository OpenSSL is cloned from if no fork is given.
+const defaultOpenSSLRepo = "https://github.com/openssl/openssl"
+
+// opensslFlavor is the family of an OpenSSL tree, which decides how it's
+// configured and wrapped.
+type opensslFlavor int
+
+const (
+	opensslFlavorLegacy   opensslFlavor = iota // OpenSSL 1.1.x (or a fork of it)
+	opensslFlavorModern                        // OpenSSL 3.x (or a fork of it)
+	opensslFlavorLibreSSL                      // LibreSSL, the OpenBSD fork
+)
+
+// detectOpenSSL identifies the flavor and version of a checked out OpenSSL tree.
+// OpenSSL 3.x tracks the version in VERSION.dat, before that (and in LibreSSL) it
+// is in the opensslv.h header. As a last resort, the 1.1.x stable branch name of
+// the checked out ref is used.
+func detectOpenSSL(tgtf string, branch string) ([]byte, opensslFlavor, error) {
+	if blob, err := ioutil.ReadFile(filepath.Join(tgtf, "VERSION.dat")); err == nil {
+		strver, err := parseOpenSSLVersion(blob)
+		return strver, opensslFlavorModern, err
+	}
+	if blob, err := ioutil.ReadFile(filepath.Join(tgtf, "include", "openssl", "opensslv.h")); err == nil {
+		if match := regexp.MustCompile(`LIBRESSL_VERSION_TEXT\s+"LibreSSL ([^"\s]+)"`).FindSubmatch(blob); match != nil {
+			return match[1], opensslFlavorLibreSSL, nil
+		}
+		if match := regexp.MustCompile(`OPENSSL_VERSION_TEXT\s+"OpenSSL ([^"\s]+)`).FindSubmatch(blob); match != nil {
+			return match[1], opensslFlavorLegacy, nil
+		}
+	}
+	// LibreSSL portable only pulls its sources (headers included) in autogen.sh
+	if _, err := os.Stat(filepath.Join(tgtf, "Configure")); os.IsNotExist(err) {
+		if blob, err := ioutil.ReadFile(filepath.Join(tgtf, "VERSION")); err == nil {
+			return bytes.TrimSpace(blob), opensslFlavorLibreSSL, nil
+		}
+	}
+	if match := regexp.MustCompile(`^OpenSSL_([0-9])_([0-9])_([0-9])-stable$`).FindStringSubmatch(branch); match != nil {
+		return []byte(match[1] + "." + match[2] + "." + match[3]), opensslFlavorLegacy, nil
+	}
+	return nil, 0, errors.New("unknown OpenSSL version")
+}
+
+// latestOpenSSLBranch picks the newest stable branch from the output of a `git
+// ls-remote --heads`. Up until 1.1.1 these were named OpenSSL_x_y_z-stable, since 3.0 they
+// are named openssl-x.y and are preferred whenever available.
+func latestOpenSSLBranch(branches []byte) (string, error) {
+	var (
+		latest string
+		minor  = -1
+	)
+	for _, match := range regexp.MustCompile(`(?m)refs/heads/(openssl-3\.([0-9]+))$`).FindAllSubmatch(branches, -1) {
+		if n, _ := strconv.Atoi(string(match[2])); n > minor {
+			latest, minor = string(match[1]), n
+		}
+	}
+	if latest != "" {
+		return latest, nil
+	}
+	stables := regexp.MustCompile("refs/heads/(OpenSSL_[0-9]_[0-9]_[0-9]-stable)").FindAllSubmatch(branches, -1)
+	if len(stables) == 0 {
+		return "", errors.New("no stable branch found")
+	}
+	return string(stables[len(stables)-1][1]), nil
+}
+
+// parseOpenSSLVersion assembles the version string from the VERSION.dat file of
+// OpenSSL 3.x, appending the pre-release tag (e.g. dev) if any.
+func parseOpenSSLVersion(blob []byte) ([]byte, error) {
+	fields := make(map[string]string)
+	for _, match := range regexp.MustCompile(`(?m)^([A-Z_]+)=(.*)$`).FindAllSubmatch(blob, -1) {
+		fields[string(match[1])] = strings.Trim(string(bytes.TrimSpace(match[2])), `"`)
+	}
+	if fields["MAJOR"] == "" || fields["MINOR"] == "" || fields["PATCH"] == "" {
+		return nil, errors.New("incomplete OpenSSL VERSION.dat")
+	}
+	version := fields["MAJOR"] + "." + fields["MINOR"] + "." + fields["PATCH"]
+	if tag := fields["PRE_RELEASE_TAG"]; tag != "" {
+		version += "-" + tag
+	}
+	return []byte(version), nil
+}
+
+// opensslUnused is the curated list of OpenSSL algorithms and features Tor has
+// no use for, dropped from the library with --minimal-openssl. Tor only needs the
+// AES, SHA, RSA, DH and NIST curve primitives plus TLS, its own ed25519, x25519
+// and SHA-3 implementations living in its source tree.
+var opensslUnused = []string{
+	"aria", "bf", "camellia", "cast", "cms", "idea", "md4", "mdc2", "rc2",
+	"rmd160", "seed", "sm2", "sm3", "sm4", "srp", "ts", "whirlpool",
+}
+
+// configureOpenSSL configures the OpenSSL library for compilation, either fully
+// portable or with assembly enabled for the host architecture, and returns the
+// output of a make dry run listing all the compilation steps.
+func configureOpenSSL(tgtf string, modern bool, asm bool) ([]byte, error) {
+	defer stage("openssl", "configure")()
+
+	// On 3.x the providers are built into libcrypto (no-module) to avoid loading
+	// them dynamically at runtime.
+	args := []string{"no-shared", "no-zlib", "no-async", "no-sctp"}
+	if !asm {
+		args = append(args, "no-asm")
+	}
+	if modern {
+		args = append(args, "no-module")
+	}
+	if *minimalOpenSSL {
+		for _, alg := range opensslUnused {
+			args = append(args, "no-"+alg)
+		}
+	}
+	config := exec.Command("./config", args...)
+	config.Dir = tgtf
+	config.Stdout = os.Stdout
+	config.Stderr = os.Stderr
+
+	if err := config.Run(); err != nil {
+		return nil, fmt.Errorf("configure failed: %v", err)
+	}
+	// OpenSSL 3.x generates most of its public headers and some sources from
+	// templates, which the dry run below would only print, not create.
+	if modern {
+		generator := exec.Command(makeTool(), "build_generated")
+		generator.Dir = tgtf
+		generator.Stdout = os.Stdout
+		generator.Stderr = os.Stderr
+
+		if err := generator.Run(); err != nil {
+			return nil, fmt.Errorf("header generation failed: %v", err)
+		}
+	}
+	// Hook the make system and gather the needed sources
+	maker := exec.Command(makeTool(), "--dry-run")
+	maker.Dir = tgtf
+
+	out, err := maker.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(out))
+		return nil, fmt.Errorf("make dry run failed: %v", err)
+	}
+	return out, nil
+}
+
+// uniqueSources drops the repeated entries from a list of scraped sources and
+// sorts the rest, so the wrappers come out the same regardless of the order make
+// happened to list them in.
+func uniqueSources(deps [][]string) [][]string {
+	seen := make(map[string]bool)
+	unique := deps[:0]
+	for _, dep := range deps {
+		if !seen[dep[1]] {
+			seen[dep[1]] = true
+			unique = append(unique, dep)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i][1] < unique[j][1] })
+	return unique
+}
+
+// opensslAsmSources is the difference between the portable and the assembly
+// enabled OpenSSL builds on the host architecture.
+type opensslAsmSources struct {
+	Generic  map[string]bool // C sources only needed without assembly
+	Specific []string        // C sources only needed with assembly
+	Asm      []string        // Assembly sources generated by the perlasm scripts
+	Defines  []string        // Preprocessor macros enabling the assembly code paths
+}
+
+// diffOpenSSLAsm compares the make dry runs of the portable and assembly enabled
+// OpenSSL builds, and generates the assembly sources needed by the latter.
+func diffOpenSSLAsm(tgtf string, deps [][]string, portable []byte, assembly []byte) (*opensslAsmSources, error) {
+	srcs := &opensslAsmSources{Generic: make(map[string]bool)}
+
+	// Sort out which C sources are needed by which build
+	specific := make(map[string]bool)
+	for _, dep := range uniqueSources(regexp.MustCompile("(?m)([a-z0-9_/-]+)\\.c$").FindAllStringSubmatch(string(assembly), -1)) {
+		specific[dep[1]] = true
+	}
+	for _, dep := range deps {
+		if !specific[dep[1]] {
+			srcs.Generic[dep[1]] = true
+		}
+		delete(specific, dep[1])
+	}
+	for src := range specific {
+		if !strings.HasPrefix(src, "apps/") && !strings.HasPrefix(src, "fuzz/") && !strings.HasPrefix(src, "test/") {
+			srcs.Specific = append(srcs.Specific, src)
+		}
+	}
+	sort.Strings(srcs.Specific)
 
-	if err := config.Run(); err != nil {
-		return "", "", err
+	// Gather the assembly sources, which the build generates from perl scripts
+	for _, dep := range uniqueSources(regexp.MustCompile("(?m)([a-z0-9_/-]+\\.[sS])$").FindAllStringSubmatch(string(assembly), -1)) {
+		if !strings.HasPrefix(dep[1], "apps/") && !strings.HasPrefix(dep[1], "fuzz/") && !strings.HasPrefix(dep[1], "test/") {
+			srcs.Asm = append(srcs.Asm, dep[1])
+		}
 	}
-	// Hook the make system and gather the needed sources
-	maker := exec.Command("make", "--dry-run")
-	maker.Dir = tgtf
+	if len(srcs.Asm) == 0 {
+		return nil, errors.New("no OpenSSL assembly sources found")
+	}
+	generator := exec.Command(makeTool(), srcs.Asm...)
+	generator.Dir = tgtf
+	generator.Stdout = os.Stdout
+	generator.Stderr = os.Stderr
 
-	if out, err = maker.CombinedOutput(); err != nil {
-		fmt.Println(string(out))
-		return "", "", err
+	if err := generator.Run(); err != nil {
+		return nil, fmt.Errorf("assembly generation failed: %v", err)
 	}
-	deps := regexp.MustCompile("(?m)([a-z0-9_/-]+)\\.c$").FindAllStringSubmatch(string(out), -1)
+	// Collect the macros only defined in the assembly build (e.g. AES_ASM), only
+	// simple flags are expected, the valued ones are the same in both builds
+	defines := regexp.MustCompile(`\s-D([A-Za-z0-9_]+)(\s|$)`)
 
-	// Wipe everything from the library that's non-essential
-	files, err := ioutil.ReadDir(tgtf)
-	if err != nil {
-		return "", "", err
+	seen := make(map[string]bool)
+	for _, match := range defines.FindAllSubmatch(portable, -1) {
+		seen[string(match[1])] = true
 	}
-	for _, file := range files {
-		// Remove all folders apart from the headers
-		if file.IsDir() {
-			if file.Name() == "crypto" || file.Name() == "engines" || file.Name() == "include" || file.Name() == "ssl" {
-				continue
-			}
-			os.RemoveAll(filepath.Join(tgtf, file.Name()))
-			continue
+	for _, match := range defines.FindAllSubmatch(assembly, -1) {
+		if !seen[string(match[1])] {
+			seen[string(match[1])] = true
+			srcs.Defines = append(srcs.Defines, string(match[1]))
 		}
-		// Remove all files apart from the license and sources
-		if file.Name() == "LICENSE" {
-			continue
+	}
+	sort.Strings(srcs.Defines)
+	return srcs, nil
+}
+
+// archFilter restricts the build tags of a target to (or away from) a single
+// architecture.
+func archFilter(tgt string, arch string, include bool) string {
+	all := append(append([]string{}, donnaArches64...), donnaArches32...)
+
+	var clauses []string
+	for _, clause := range strings.Fields(targetFilters[tgt]) {
+		// Find the architecture the clause is already constrained to, if any
+		var pinned string
+		for _, tag := range strings.Split(clause, ",") {
+			for _, known := range all {
+				if tag == known {
+					pinned = tag
+				}
+			}
 		}
-		if ext := filepath.Ext(file.Name()); ext != ".h" && ext != ".c" {
-			os.Remove(filepath.Join(tgtf, file.Name()))
+		switch {
+		case pinned == "" && include:
+			clauses = append(clauses, clause+","+arch)
+		case pinned == "":
+			clauses = append(clauses, clause+",!"+arch)
+		case (pinned == arch) == include:
+			clauses = append(clauses, clause)
 		}
 	}
+	return strings.Join(clauses, " ")
+}
 
-	// TarGeTFILTer
-	tgtFilt := targetFilters[tgt]
+// wrapOpenSSLAsm generates the Go wrappers for the architecture specific OpenSSL
+// sources: the C sources only needed with assembly, the assembly sources and a
+// preamble enabling the assembly code paths.
+func wrapOpenSSLAsm(tgt string, modern bool, srcs *opensslAsmSources) error {
+	filter := archFilter(tgt, *asm, true)
 
-	// Generate Go wrappers for each C source individually
 	tmpl, err := template.New("").Parse(opensslTemplate)
 	if err != nil {
-		return "", "", err
+		return err
 	}
-	for _, dep := range deps {
-		// Skip any files not needed for the library
-		if strings.HasPrefix(dep[1], "apps/") {
-			continue
-		}
-		if strings.HasPrefix(dep[1], "fuzz/") {
-			continue
-		}
-		if strings.HasPrefix(dep[1], "test/") {
-			continue
+	for _, src := range srcs.Specific {
+		gofile := strings.Replace(src, "/", "_", -1) + ".go"
+		buff := new(bytes.Buffer)
+		if err := tmpl.Execute(buff, map[string]interface{}{
+			"TargetFilter": filter,
+			"File":         src,
+			"Modern":       modern,
+		}); err != nil {
+			return err
 		}
-		// Anything else is wrapped directly with Go
-		gofile := strings.Replace(dep[1], "/", "_", -1) + ".go"
+		writeWrapper("openssl", src+".c", filepath.Join("libtor", tgt+"_openssl_"+gofile), buff.Bytes())
+	}
+	tmpl, err = template.New("").Parse(opensslAsmTemplate)
+	if err != nil {
+		return err
+	}
+	for _, src := range srcs.Asm {
+		// Go only passes capitalized .S files to the C compiler, .s is Go assembly
+		asmfile := strings.Replace(strings.TrimSuffix(src, filepath.Ext(src)), "/", "_", -1) + ".S"
 		buff := new(bytes.Buffer)
 		if err := tmpl.Execute(buff, map[string]string{
-			"TargetFilter": tgtFilt,
-			"File":         dep[1],
+			"TargetFilter": filter,
+			"File":         src,
 		}); err != nil {
-			return "", "", err
+			return err
 		}
-		ioutil.WriteFile(filepath.Join("libtor", tgt+"_openssl_"+gofile), buff.Bytes(), 0644)
+		writeWrapper("openssl", src, filepath.Join("libtor", tgt+"_openssl_"+asmfile), buff.Bytes())
 	}
-	tmpl, err = template.New("").Parse(opensslPreamble)
+	tmpl, err = template.New("").Parse(opensslAsmPreamble)
 	if err != nil {
-		return "", "", err
+		return err
 	}
 	buff := new(bytes.Buffer)
-	if err := tmpl.Execute(buff, map[string]string{
-		"TargetFilter": tgtFilt,
-		"Target":       tgt,
+	if err := tmpl.Execute(buff, map[string]interface{}{
+		"TargetFilter": filter,
+		"Defines":      srcs.Defines,
 	}); err != nil {
-		return "", "", err
-	}
-	ioutil.WriteFile(filepath.Join("libtor", tgt+"_openssl_preamble.go"), buff.Bytes(), 0644)
-
-	// Inject the configuration headers and ensure everything builds
-	os.MkdirAll(filepath.Join("openssl_config", "crypto"), 0755)
-
-	for _, arch := range []string{"", ".linux", ".darwin"} {
-		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("dso_conf%s.h", arch)))
-		ioutil.WriteFile(filepath.Join("openssl_config", "crypto", fmt.Sprintf("dso_conf%s.h", arch)), blob, 0644)
-	}
-
-	for _, arch := range []string{"", ".x64", ".x86"} {
-		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("bn_conf%s.h", arch)))
-		ioutil.WriteFile(filepath.Join("openssl_config", "crypto", fmt.Sprintf("bn_conf%s.h", arch)), blob, 0644)
-	}
-	for _, arch := range []string{"", ".x64", ".x86", ".macos64", ".ios64"} {
-		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("buildinf%s.h", arch)))
-		tmpl, err := template.New("").Parse(string(blob))
-		if err != nil {
-			return "", "", err
-		}
-		buff := new(bytes.Buffer)
-		if err := tmpl.Execute(buff, struct{ Date string }{string(date)}); err != nil {
-			return "", "", err
-		}
-		ioutil.WriteFile(filepath.Join("openssl_config", fmt.Sprintf("buildinf%s.h", arch)), buff.Bytes(), 0644)
-	}
-	os.MkdirAll(filepath.Join("openssl_config", "openssl"), 0755)
-
-	for _, arch := range []string{"", ".x64", ".x86", ".macos64", ".ios64"} {
-		blob, _ := ioutil.ReadFile(filepath.Join("config", "openssl", fmt.Sprintf("opensslconf%s.h", arch)))
-		ioutil.WriteFile(filepath.Join("openssl_config", "openssl", fmt.Sprintf("opensslconf%s.h", arch)), blob, 0644)
+		return err
 	}
-	return string(strver), string(commit), nil
+	return writeOutput(filepath.Join("libtor", tgt+"_openssl_asm_preamble.go"), buff.Bytes())
 }
 
 // opensslPreamble is the CGO preamble injected to configure the C compiler.
 var opensslPreamble = `// go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
 // +build {{.TargetFilter}}
+// +build !system_openssl
 
 package libtor
 
@@ -667,14 +3382,50 @@ package libtor
 #cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/openssl/crypto/ec/curve448
 #cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/openssl/crypto/ec/curve448/arch_32
 #cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/openssl/crypto/modes
+{{- if .Modern}}
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/openssl/crypto
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/openssl/providers/common/include
+#cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/openssl/providers/implementations/include
+#cgo CFLAGS: -DOPENSSL_BUILDING_OPENSSL
+{{- end}}
+{{- range .Disabled}}
+#cgo CFLAGS: -DOPENSSL_NO_{{.}}
+{{- end}}
+*/
+import "C"
+
+func init() {
+	wrappedVersions["openssl"] = "{{.Version}}"
+}
+`
+
+// opensslSystemPreamble is the CGO preamble linking the system OpenSSL instead of
+// the wrapped one, built with the system_openssl tag (e.g. for distro packages).
+var opensslSystemPreamble = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+// +build system_openssl
+
+package libtor
+
+/*
+#cgo pkg-config: libssl libcrypto
+
+#include <openssl/crypto.h>
 */
 import "C"
+
+// The system OpenSSL is linked at runtime, so its version is only known then
+func init() {
+	wrappedVersions["openssl"] = C.GoString(C.OpenSSL_version(C.OPENSSL_VERSION))
+}
 `
 
 // opensslTemplate is the source file template used in OpenSSL Go wrappers.
 var opensslTemplate = `// go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
 // +build {{.TargetFilter}}
+// +build !system_openssl
 
 package libtor
 
@@ -682,38 +3433,81 @@ package libtor
 #define DSO_NONE
 #define OPENSSLDIR "/usr/local/ssl"
 #define ENGINESDIR "/usr/local/lib/engines"
+{{- if .Modern}}
+#define MODULESDIR "/usr/local/lib/ossl-modules"
+{{- end}}
 
 #include <../{{.File}}.c>
 */
 import "C"
 `
 
+// opensslAsmPreamble is the CGO preamble injected to enable the OpenSSL assembly
+// code paths on the architecture it was generated for.
+var opensslAsmPreamble = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+// +build !system_openssl
+
+package libtor
+
+/*
+#cgo CFLAGS: -DLIBTOR_OPENSSL_ASM
+{{- range .Defines}}
+#cgo CFLAGS: -D{{.}}
+{{- end}}
+*/
+import "C"
+`
+
+// opensslAsmTemplate is the source file template used in OpenSSL assembly wrappers.
+var opensslAsmTemplate = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+// +build !system_openssl
+
+#include <../{{.File}}>
+`
+
+// defaultTorRef is the Tor branch wrapped if neither a lock nor an explicit ref
+// is given.
+const defaultTorRef = "maint-0.4.7"
+
+// commitRegexp matches a full git commit hash.
+var commitRegexp = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// torMirrors are the repositories Tor is cloned from, tried in order until one
+// succeeds. The canonical one is frequently unreachable from CI networks.
+var torMirrors = []string{
+	"https://git.torproject.org/tor.git",
+	"https://gitlab.torproject.org/tpo/core/tor.git",
+	"https://github.com/torproject/tor.git",
+}
+
 // wrapTor clones the Tor library into the local repository and wraps it into a
 // Go package.
 func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 	// TarGeT Full
 	tgtf := filepath.Join(tgt, "tor")
 
-	cloner := exec.Command("git", "clone", "https://git.torproject.org/tor.git")
-	cloner.Stdout = os.Stdout
-	cloner.Stderr = os.Stderr
-	cloner.Dir = tgt
-
-	if err := cloner.Run(); err != nil {
-		return "", "", err
-	}
-
-	var checkout string
-	// If we have a commit lock, checkout these commits.
+	// If we have a commit lock, checkout these commits, unless a specific ref was
+	// requested, which is either a full commit hash or a branch or tag name.
+	branch, lockCommit := defaultTorRef, ""
 	if lock != nil {
-		checkout = lock.Tor
-	} else {
-		checkout = "maint-0.4.7"
+		lockCommit = lock.Tor
 	}
-	checkouter := exec.Command("git", "checkout", checkout)
-	checkouter.Dir = tgtf
-
-	if err := checkouter.Run(); err != nil {
+	if *torRef != "" {
+		branch, lockCommit = *torRef, ""
+		if commitRegexp.MatchString(*torRef) {
+			branch, lockCommit = "", *torRef
+		}
+	}
+	// Try the official repository and fall back to its mirrors if unreachable
+	repos := torMirrors
+	if *torRepo != "" {
+		repos = []string{*torRepo}
+	}
+	if err := fetchRepo("tor", repos, tgtf, branch, lockCommit); err != nil {
 		return "", "", err
 	}
 	// Save the latest upstream commit hash for later reference
@@ -723,50 +3517,70 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 	commit, err := parser.CombinedOutput()
 	if err != nil {
 		fmt.Println(string(commit))
-		return "", "", err
+		return "", "", fmt.Errorf("commit lookup failed: %v", err)
 	}
 	commit = bytes.TrimSpace(commit)
+	if *fetchOnly {
+		return "", string(commit), nil
+	}
 
-	// Configure the library for compilation
-	autogen := exec.Command("./autogen.sh")
-	autogen.Dir = tgtf
-	autogen.Stdout = os.Stdout
-	autogen.Stderr = os.Stderr
+	// Remember the sources in the repository to checksum them after wiping
+	tracked, err := trackedFiles(tgtf)
+	if err != nil {
+		return "", "", err
+	}
 
-	if err := autogen.Run(); err != nil {
+	// Retrieve the version of the current commit
+	winconf, _ := ioutil.ReadFile(filepath.Join(tgtf, "src", "win32", "orconfig.h"))
+	strver, err := extractVersion(winconf, "define VERSION \"(.+)\"")
+	if err != nil {
 		return "", "", err
 	}
-	configureArgs := []string{
-		"--disable-asciidoc",
+	// Make sure the GPL modules exist before building something else than asked
+	if *enableGPL {
+		blob, _ := ioutil.ReadFile(filepath.Join(tgtf, "configure.ac"))
+		if !bytes.Contains(blob, []byte("ENABLE_GPL")) {
+			return "", "", fmt.Errorf("GPL modules not supported by Tor %s", strver)
+		}
+		fmt.Printf("Wrapping Tor %s with its GPL modules, the library is covered by the GPL\n", strver)
 	}
-	// If you're using M1 or later CPUs, homebrew installs under /opt/local as
-	// opposed to /usr/local. We need to tell tor's configure about that.
-	if info, err := os.Stat("/opt/homebrew"); err == nil && info.IsDir() {
-		configureArgs = append(configureArgs, "--with-libevent-dir=/opt/homebrew/")
-		configureArgs = append(configureArgs, "--with-openssl-dir=/opt/homebrew/opt/openssl@1.1/")
+	// Gather the needed sources, either from the make system or a previous run
+	var deps [][]string
+	if *noConfigure {
+		if deps, err = recordedSources("tor", ""); err != nil {
+			return "", "", err
+		}
+		// The 32 bit donna flavors are derived from the -c64 sources, drop them
+		recorded := make(map[string]bool)
+		for _, dep := range deps {
+			recorded[dep[1]] = true
+		}
+		filtered := deps[:0]
+		for _, dep := range deps {
+			if !recorded[dep[1]+"-c64"] {
+				filtered = append(filtered, dep)
+			}
+		}
+		deps = filtered
+	} else {
+		out, err := configureTor(tgt, tgtf)
+		if err != nil {
+			return "", "", err
+		}
+		deps = uniqueSources(regexp.MustCompile("(?m)([a-z0-9_/-]+)\\.c").FindAllStringSubmatch(string(out), -1))
 	}
-	configure := exec.Command("./configure", configureArgs...)
-	configure.Dir = tgtf
-	configure.Stdout = os.Stdout
-	configure.Stderr = os.Stderr
-
-	if err := configure.Run(); err != nil {
+	if err := checkSources("tor", deps); err != nil {
 		return "", "", err
 	}
-	// Retrieve the version of the current commit
-	winconf, _ := ioutil.ReadFile(filepath.Join(tgtf, "src", "win32", "orconfig.h"))
-	strver := regexp.MustCompile("define VERSION \"(.+)\"").FindSubmatch(winconf)[1]
-
-	// Hook the make system and gather the needed sources
-	maker := exec.Command("make", "--dry-run")
-	maker.Dir = tgtf
-
-	out, err := maker.CombinedOutput()
+	// Save the GeoIP databases before the wipe, they are embedded into the library
+	geoip, err := ioutil.ReadFile(filepath.Join(tgtf, "src", "config", "geoip"))
 	if err != nil {
-		fmt.Println(string(out))
-		return "", "", err
+		return "", "", fmt.Errorf("geoip database missing: %v", err)
+	}
+	geoip6, err := ioutil.ReadFile(filepath.Join(tgtf, "src", "config", "geoip6"))
+	if err != nil {
+		return "", "", fmt.Errorf("geoip6 database missing: %v", err)
 	}
-	deps := regexp.MustCompile("(?m)([a-z0-9_/-]+)\\.c").FindAllStringSubmatch(string(out), -1)
 
 	// Wipe everything from the library that's non-essential
 	files, err := ioutil.ReadDir(tgtf)
@@ -776,7 +3590,7 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 	for _, file := range files {
 		// Remove all folders apart from the sources
 		if file.IsDir() {
-			if file.Name() == "src" {
+			if file.Name() == "src" || keepClone(file.Name()) {
 				continue
 			}
 			os.RemoveAll(filepath.Join(tgtf, file.Name()))
@@ -818,13 +3632,43 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 	); err != nil {
 		return "", "", err
 	}
+	// Ensure the remaining sources are the ones locked, unless overridden
+	verify := lock
+	if *torRef != "" {
+		verify = nil
+	}
+	if err := checkTree("tor", tgtf, tracked, verify); err != nil {
+		return "", "", err
+	}
 	// Fix the string compatibility source to load the correct code
-	blob, _ := ioutil.ReadFile(filepath.Join(tgtf, "src", "lib", "string", "compat_string.c"))
-	ioutil.WriteFile(filepath.Join(tgtf, "src", "lib", "string", "compat_string.c"), bytes.Replace(blob, []byte("strlcpy.c"), []byte("ext/strlcpy.c"), -1), 0644)
+	if err := fixStrlIncludes(tgtf); err != nil {
+		return "", "", err
+	}
+
+	// Force conflux on or off if requested by flipping its option default
+	if *conflux != "auto" {
+		path := filepath.Join(tgtf, "src", "app", "config", "config.c")
+		blob, _ := ioutil.ReadFile(path)
+
+		matcher := regexp.MustCompile(`V\(ConfluxEnabled,(\s*)AUTOBOOL,(\s*)"auto"\)`)
+		if !matcher.Match(blob) {
+			return "", "", fmt.Errorf("conflux not supported by Tor %s", strver)
+		}
+		value := "0"
+		if *conflux == "on" {
+			value = "1"
+		}
+		ioutil.WriteFile(path, matcher.ReplaceAll(blob, []byte(`V(ConfluxEnabled,${1}AUTOBOOL,${2}"`+value+`")`)), 0644)
+	}
 
 	// TarGeTFILTer
 	tgtFilt := targetFilters[tgt]
 
+	// Remove any previous Tor wrappers, as the wrapped modules might have changed
+	stale, _ := filepath.Glob(filepath.Join("libtor", tgt+"_tor_*.go"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
 	tmpl, err := template.New("").Parse(torTemplate)
 	if err != nil {
 		return "", "", err
@@ -846,7 +3690,7 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 		}
 		// The donna crypto library needs architecture specific linking
 		if strings.HasSuffix(dep[1], "-c64") {
-			for _, arch := range []string{"amd64", "arm64"} {
+			for _, arch := range donnaArches64 {
 				gofile := strings.Replace(dep[1], "/", "_", -1) + "_" + arch + ".go"
 				buff := new(bytes.Buffer)
 				if err := tmpl.Execute(buff, map[string]string{
@@ -855,9 +3699,9 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 				}); err != nil {
 					return "", "", err
 				}
-				ioutil.WriteFile(filepath.Join("libtor", tgt+"_tor_"+gofile), buff.Bytes(), 0644)
+				writeWrapper("tor", dep[1]+".c", filepath.Join("libtor", tgt+"_tor_"+gofile), buff.Bytes())
 			}
-			for _, arch := range []string{"386", "arm"} {
+			for _, arch := range donnaArches32 {
 				gofile := strings.Replace(dep[1], "/", "_", -1) + "_" + arch + ".go"
 				buff := new(bytes.Buffer)
 				if err := tmpl.Execute(buff, map[string]string{
@@ -866,7 +3710,7 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 				}); err != nil {
 					return "", "", err
 				}
-				ioutil.WriteFile(filepath.Join("libtor", tgt+"_tor_"+gofile), buff.Bytes(), 0644)
+				writeWrapper("tor", strings.Replace(dep[1], "-c64", "", -1)+".c", filepath.Join("libtor", tgt+"_tor_"+gofile), buff.Bytes())
 			}
 			continue
 		}
@@ -879,41 +3723,151 @@ func wrapTor(tgt string, lock *lockJson) (string, string, error) {
 		}); err != nil {
 			return "", "", err
 		}
-		ioutil.WriteFile(filepath.Join("libtor", tgt+"_tor_"+gofile), buff.Bytes(), 0644)
+		writeWrapper("tor", dep[1]+".c", filepath.Join("libtor", tgt+"_tor_"+gofile), buff.Bytes())
 	}
 	tmpl, err = template.New("").Parse(torPreamble)
 	if err != nil {
 		return "", "", err
 	}
 	buff := new(bytes.Buffer)
-	if err := tmpl.Execute(buff, map[string]string{
+	if err := tmpl.Execute(buff, map[string]interface{}{
 		"TargetFilter": tgtFilt,
 		"Target":       tgt,
+		"Version":      string(strver),
+		"ClientOnly":   *clientOnly,
+		"GPL":          *enableGPL,
+		"CFlags":       strings.Join(strings.Fields(*extraCFlags), " "),
+	}); err != nil {
+		return "", "", err
+	}
+	writeOutput(filepath.Join("libtor", tgt+"_tor_preamble.go"), buff.Bytes())
+
+	// Embed the GeoIP databases, needed for country based node selection
+	writeOutput(filepath.Join("libtor", "geoip"), geoip)
+	writeOutput(filepath.Join("libtor", "geoip6"), geoip6)
+
+	tmpl, err = template.New("").Parse(torGeoIPTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	buff = new(bytes.Buffer)
+	if err := tmpl.Execute(buff, map[string]string{
+		"TargetFilter": tgtFilt,
 	}); err != nil {
 		return "", "", err
 	}
-	ioutil.WriteFile(filepath.Join("libtor", tgt+"_tor_preamble.go"), buff.Bytes(), 0644)
+	writeOutput(filepath.Join("libtor", tgt+"_tor_geoip.go"), buff.Bytes())
 
 	// Inject the configuration headers and ensure everything builds
 	os.MkdirAll(filepath.Join("tor_config"), 0755)
 
-	for _, arch := range []string{"", ".linux64", ".linux32", ".android64", ".android32", ".macos64", ".ios64"} {
+	// The version reported by Tor is the upstream one unless explicitly overridden
+	version := string(strver)
+	if *torVersion != "" {
+		version = *torVersion
+	}
+	for _, arch := range torConfigs {
 		blob, _ := ioutil.ReadFile(filepath.Join("config", "tor", fmt.Sprintf("orconfig%s.h", arch)))
 		tmpl, err := template.New("").Parse(string(blob))
 		if err != nil {
 			return "", "", err
 		}
 		buff := new(bytes.Buffer)
-		if err := tmpl.Execute(buff, struct{ StrVer string }{string(strver)}); err != nil {
+		if err := tmpl.Execute(buff, struct{ StrVer, Version string }{string(strver), version}); err != nil {
 			return "", "", err
 		}
-		ioutil.WriteFile(filepath.Join("tor_config", fmt.Sprintf("orconfig%s.h", arch)), buff.Bytes(), 0644)
+		writeOutput(filepath.Join("tor_config", fmt.Sprintf("orconfig%s.h", arch)), buff.Bytes())
 	}
-	blob, _ = ioutil.ReadFile(filepath.Join("config", "tor", "micro-revision.i"))
-	ioutil.WriteFile(filepath.Join("tor_config", "micro-revision.i"), blob, 0644)
+	blob, _ := ioutil.ReadFile(filepath.Join("config", "tor", "micro-revision.i"))
+	writeOutput(filepath.Join("tor_config", "micro-revision.i"), blob)
 	return string(strver), string(commit), nil
 }
 
+// configureTor configures the Tor library for compilation against the vendored
+// dependencies and returns the output of a make dry run listing all the
+// compilation steps.
+func configureTor(tgt string, tgtf string) ([]byte, error) {
+	defer stage("tor", "configure")()
+
+	autogen := exec.Command("./autogen.sh")
+	autogen.Dir = tgtf
+	autogen.Stdout = os.Stdout
+	autogen.Stderr = os.Stderr
+
+	if err := autogen.Run(); err != nil {
+		return nil, fmt.Errorf("autogen failed: %v", err)
+	}
+	configureArgs := []string{
+		"--disable-asciidoc",
+	}
+	// If you're using M1 or later CPUs, homebrew installs under /opt/homebrew as
+	// opposed to /usr/local. Either way, its OpenSSL is keg-only, so we need to
+	// tell tor's configure where to find them.
+	if runtime.GOOS == "darwin" {
+		for _, prefix := range []string{"/opt/homebrew", "/usr/local"} {
+			if _, err := os.Stat(filepath.Join(prefix, "bin", "brew")); err != nil {
+				continue
+			}
+			openssl, err := homebrewOpenSSL(prefix)
+			if err != nil {
+				return nil, err
+			}
+			configureArgs = append(configureArgs, "--with-libevent-dir="+prefix+"/")
+			configureArgs = append(configureArgs, "--with-openssl-dir="+openssl+"/")
+			break
+		}
+	}
+	// Enable zstd, pointing configure to the vendored sources instead of a system
+	// install. The library is never linked, only the make dry run is needed.
+	zstdDir, err := filepath.Abs(filepath.Join(tgt, "zstd", "lib"))
+	if err != nil {
+		return nil, err
+	}
+	configureArgs = append(configureArgs, "--enable-zstd")
+
+	// Enable LZMA similarly if it's vendored, otherwise make sure it's disabled
+	lzmaDir, err := filepath.Abs(filepath.Join(tgt, "lzma", "src", "liblzma", "api"))
+	if err != nil {
+		return nil, err
+	}
+	if *withLzma {
+		configureArgs = append(configureArgs, "--enable-lzma")
+	} else {
+		configureArgs = append(configureArgs, "--disable-lzma")
+	}
+	// Drop the relay and dirauth modules if requested, make will pick their stubs
+	if *clientOnly {
+		configureArgs = append(configureArgs, "--disable-module-relay", "--disable-module-dirauth")
+	}
+	// Allow the GPL licensed modules if requested, make will pick them up
+	if *enableGPL {
+		configureArgs = append(configureArgs, "--enable-gpl")
+	}
+
+	configure := exec.Command("./configure", configureArgs...)
+	configure.Dir = tgtf
+	configure.Stdout = os.Stdout
+	configure.Stderr = os.Stderr
+	configure.Env = append(os.Environ(),
+		"ZSTD_CFLAGS=-I"+zstdDir, "ZSTD_LIBS=-lzstd",
+		"LZMA_CFLAGS=-I"+lzmaDir, "LZMA_LIBS=-llzma",
+	)
+
+	if err := configure.Run(); err != nil {
+		return nil, fmt.Errorf("configure failed: %v", err)
+	}
+	// Hook the make system and gather the needed sources
+	maker := exec.Command(makeTool(), "--dry-run")
+	maker.Dir = tgtf
+
+	out, err := maker.CombinedOutput()
+	if err != nil {
+		fmt.Println(string(out))
+		return nil, fmt.Errorf("make dry run failed: %v", err)
+	}
+	return out, nil
+}
+
 // torPreamble is the CGO preamble injected to configure the C compiler.
 var torPreamble = `// go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
@@ -931,10 +3885,37 @@ package libtor
 #cgo CFLAGS: -I${SRCDIR}/../{{.Target}}/tor/src/feature/api
 
 #cgo CFLAGS: -DED25519_CUSTOMRANDOM -DED25519_CUSTOMHASH -DED25519_SUFFIX=_donna
-
+{{if .ClientOnly}}#cgo CFLAGS: -DLIBTOR_CLIENT_ONLY
+{{end}}{{if .GPL}}#cgo CFLAGS: -DLIBTOR_GPL
+{{end}}{{if .CFlags}}#cgo CFLAGS: {{.CFlags}}
+{{end}}
 #cgo LDFLAGS: -lm
 */
 import "C"
+
+func init() {
+	wrappedVersions["tor"] = "{{.Version}}"
+}
+`
+
+// torGeoIPTemplate is the Go file embedding Tor's GeoIP databases.
+var torGeoIPTemplate = `// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build {{.TargetFilter}}
+
+package libtor
+
+import _ "embed"
+
+//go:embed geoip
+var torGeoIP []byte
+
+//go:embed geoip6
+var torGeoIP6 []byte
+
+func init() {
+	geoipDB, geoip6DB = torGeoIP, torGeoIP6
+}
 `
 
 // torTemplate is the source file template used in Tor Go wrappers.
@@ -0,0 +1,114 @@
+//go:build capi
+// +build capi
+
+// Command capi is a C shim around the embedded Tor, meant to be packaged as a C
+// static archive or shared library and linked into non-Go projects (e.g. C,
+// Swift or JNI ones), which get the exported functions via the generated header:
+//
+//	go build -tags capi -buildmode=c-archive -o libtor.a ./capi
+//	go build -tags capi -buildmode=c-shared -o libtor.so ./capi
+//
+// It's only built with the capi tag, so plain go build ./... runs don't try to
+// link a binary out of it.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"unsafe"
+
+	"github.com/ooni/go-libtor"
+)
+
+// Exit codes reported by RunTor and StartTor besides the ones of Tor itself.
+const (
+	exitRunning = libtor.TorExitBusy // Another Tor is already running in the process
+	exitFailure = -1                 // Tor could not be started (e.g. invalid arguments)
+)
+
+var (
+	lock sync.Mutex // Protects the stop function of the running Tor
+	stop func()     // Stops the Tor started by RunTor or StartTor, nil if none
+)
+
+// LibtorVersion returns the Tor provider name and version exposed from the
+// Tor embedded API. The caller owns the returned string and must free it.
+//
+//export LibtorVersion
+func LibtorVersion() *C.char {
+	return C.CString(libtor.ProviderVersion())
+}
+
+// RunTor starts an embedded Tor with the given command line arguments (without
+// the program name) and blocks until it terminates, returning its exit code. If
+// Tor could not be started -1 is returned, if one is already running -2. The
+// arguments are copied, so the caller may free them as soon as Tor started.
+//
+//export RunTor
+func RunTor(argc C.int, argv **C.char) C.int {
+	args := goArgs(argc, argv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lock.Lock()
+	if stop != nil {
+		lock.Unlock()
+		return exitRunning
+	}
+	stop = cancel
+	lock.Unlock()
+
+	defer func() {
+		lock.Lock()
+		stop = nil
+		lock.Unlock()
+	}()
+	err := libtor.RunTor(ctx, args...)
+
+	var exit *libtor.TorExitError
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return 0
+	case errors.As(err, &exit):
+		return C.int(exit.Code)
+	case errors.Is(err, libtor.ErrAlreadyRunning):
+		return exitRunning
+	default:
+		return exitFailure
+	}
+}
+
+// StopTor asks the Tor started by RunTor or StartTor to shut down gracefully,
+// RunTor returning 0 once it exited. It's a noop if no Tor is running.
+//
+//export StopTor
+func StopTor() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
+
+// goArgs copies a C array of argc strings into Go.
+func goArgs(argc C.int, argv **C.char) []string {
+	args := make([]string, 0, int(argc))
+	if argc > 0 {
+		for _, arg := range (*[1 << 28]*C.char)(unsafe.Pointer(argv))[:argc:argc] {
+			args = append(args, C.GoString(arg))
+		}
+	}
+	return args
+}
+
+// main is needed for the C archive and shared library build modes, but is never
+// called.
+func main() {}
@@ -0,0 +1,127 @@
+//go:build capi && !windows
+// +build capi,!windows
+
+package main
+
+import "C"
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/ooni/go-libtor"
+)
+
+// started is the Tor running in the background since StartTor.
+var started *startedTor
+
+// startedTor tracks the exit of a Tor started by StartTor.
+type startedTor struct {
+	done chan struct{} // Closed when Tor exited
+	code C.int         // Exit code of Tor, set before done is closed
+}
+
+// StartTor starts an embedded Tor with the given command line arguments (without
+// the program name) in the background and returns the caller's end of its owning
+// control socket, which speaks Tor's control protocol already authenticated. Tor
+// exits when the socket is closed (or on StopTor), the caller owning it. If Tor
+// could not be started -1 is returned, if one is already running -2.
+//
+//export StartTor
+func StartTor(argc C.int, argv **C.char) C.int {
+	args := goArgs(argc, argv)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if stop != nil {
+		return exitRunning
+	}
+	cfg, err := libtor.NewConfig()
+	if err != nil {
+		return exitFailure
+	}
+	if err := cfg.SetCommandLine(args); err != nil {
+		cfg.Free()
+		return exitFailure
+	}
+	conn, err := cfg.ControlSocket()
+	if err != nil {
+		cfg.Free()
+		return exitFailure
+	}
+	// Hand out a blocking duplicate of the socket, keeping another to stop Tor
+	fd, err := detachConn(conn)
+	if err != nil {
+		cfg.Free()
+		return exitFailure
+	}
+	keep, err := syscall.Dup(fd)
+	if err != nil {
+		syscall.Close(fd)
+		cfg.Free()
+		return exitFailure
+	}
+	tor := &startedTor{done: make(chan struct{})}
+	started = tor
+
+	// Shutting the socket down (unlike closing a duplicate) reaches Tor, which
+	// exits as its owning controller went away
+	stop = func() { syscall.Shutdown(keep, syscall.SHUT_RDWR) }
+
+	go func() {
+		tor.code = C.int(libtor.Run(cfg))
+		cfg.Free()
+
+		lock.Lock()
+		stop = nil
+		syscall.Close(keep)
+		lock.Unlock()
+
+		close(tor.done)
+	}()
+	return C.int(fd)
+}
+
+// WaitTor blocks until the Tor started by StartTor exits, returning its exit
+// code, or -1 if none was started.
+//
+//export WaitTor
+func WaitTor() C.int {
+	lock.Lock()
+	tor := started
+	lock.Unlock()
+
+	if tor == nil {
+		return exitFailure
+	}
+	<-tor.done
+	return tor.code
+}
+
+// detachConn duplicates the file descriptor of a connection in blocking mode, as
+// expected by non-Go code, and closes the connection itself.
+func detachConn(conn net.Conn) (int, error) {
+	defer conn.Close()
+
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	var (
+		fd   = -1
+		derr error
+	)
+	if err := raw.Control(func(sysfd uintptr) { fd, derr = syscall.Dup(int(sysfd)) }); err != nil {
+		return -1, err
+	}
+	if derr != nil {
+		return -1, derr
+	}
+	// The non-blocking mode is shared with the duplicate, so reset it
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
@@ -1,16 +1,16 @@
-#ifdef ARCH_LINUX64
+#if defined(ARCH_LINUX64) || defined(ARCH_LINUX64_MIPS) || defined(ARCH_LINUX64_PPC) || defined(ARCH_LINUX64_S390X)
   #include "event2/event-config.linux64.h"
 #endif
 
-#ifdef ARCH_LINUX32
+#if defined(ARCH_LINUX32) || defined(ARCH_LINUX32_MIPS)
   #include "event2/event-config.linux32.h"
 #endif
 
-#ifdef ARCH_MACOS64
+#if defined(ARCH_MACOS64) || defined(ARCH_MACOS64_ARM64)
   #include "event2/event-config.macos64.h"
 #endif
 
-#ifdef ARCH_IOS64
+#if defined(ARCH_IOS64) || defined(ARCH_IOS64_SIMULATOR)
   #include "event2/event-config.ios64.h"
 #endif
 
@@ -18,6 +18,26 @@
   #include "event2/event-config.android64.h"
 #endif
 
-#ifdef ARCH_ANDROID32
+#if defined(ARCH_ANDROID32) || defined(ARCH_ANDROID32_X86)
   #include "event2/event-config.android32.h"
 #endif
+
+#ifdef ARCH_WINDOWS64
+  #include "event2/event-config.windows64.h"
+#endif
+
+#ifdef ARCH_WINDOWS32
+  #include "event2/event-config.windows32.h"
+#endif
+
+#ifdef ARCH_FREEBSD64
+  #include "event2/event-config.freebsd64.h"
+#endif
+
+#ifdef ARCH_OPENBSD64
+  #include "event2/event-config.openbsd64.h"
+#endif
+
+#ifdef ARCH_NETBSD64
+  #include "event2/event-config.netbsd64.h"
+#endif
@@ -0,0 +1,52 @@
+#if defined(ARCH_LINUX64) || defined(ARCH_ANDROID64)
+  #include "openssl/configuration.x64.h"
+#endif
+
+#if defined(ARCH_LINUX32) || defined(ARCH_ANDROID32_X86)
+  #include "openssl/configuration.x86.h"
+#endif
+
+#ifdef ARCH_ANDROID32
+  #include "openssl/configuration.android32.h"
+#endif
+
+#ifdef ARCH_LINUX64_MIPS
+  #include "openssl/configuration.mips64.h"
+#endif
+
+#ifdef ARCH_LINUX32_MIPS
+  #include "openssl/configuration.mips32.h"
+#endif
+
+#ifdef ARCH_LINUX64_PPC
+  #include "openssl/configuration.ppc64le.h"
+#endif
+
+#ifdef ARCH_LINUX64_S390X
+  #include "openssl/configuration.s390x.h"
+#endif
+
+#if defined(ARCH_MACOS64) || defined(ARCH_MACOS64_ARM64)
+  #include "openssl/configuration.macos64.h"
+#endif
+
+#if defined(ARCH_IOS64) || defined(ARCH_IOS64_SIMULATOR)
+  #include "openssl/configuration.ios64.h"
+#endif
+
+#ifdef ARCH_WINDOWS64
+  #include "openssl/configuration.mingw64.h"
+#endif
+
+#ifdef ARCH_WINDOWS32
+  #include "openssl/configuration.mingw.h"
+#endif
+
+#if defined(ARCH_FREEBSD64) || defined(ARCH_OPENBSD64) || defined(ARCH_NETBSD64)
+  #include "openssl/configuration.bsd64.h"
+#endif
+
+/* The assembly enabled builds (wrap.go --asm) still share the portable configs */
+#ifdef LIBTOR_OPENSSL_ASM
+  #undef OPENSSL_NO_ASM
+#endif
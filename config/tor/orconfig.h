@@ -6,11 +6,31 @@
   #include "orconfig.linux32.h"
 #endif
 
+#ifdef ARCH_LINUX64_MIPS
+  #include "orconfig.linux64mips.h"
+#endif
+
+#ifdef ARCH_LINUX32_MIPS
+  #include "orconfig.linux32mips.h"
+#endif
+
+#ifdef ARCH_LINUX64_PPC
+  #include "orconfig.linux64ppc.h"
+#endif
+
+#ifdef ARCH_LINUX64_S390X
+  #include "orconfig.linux64s390x.h"
+#endif
+
 #ifdef ARCH_MACOS64
   #include "orconfig.macos64.h"
 #endif
 
-#ifdef ARCH_IOS64
+#ifdef ARCH_MACOS64_ARM64
+  #include "orconfig.macos64arm64.h"
+#endif
+
+#if defined(ARCH_IOS64) || defined(ARCH_IOS64_SIMULATOR)
   #include "orconfig.ios64.h"
 #endif
 
@@ -21,3 +41,51 @@
 #ifdef ARCH_ANDROID32
   #include "orconfig.android32.h"
 #endif
+
+#ifdef ARCH_ANDROID32_X86
+  #include "orconfig.android32x86.h"
+#endif
+
+#ifdef ARCH_WINDOWS64
+  #include "orconfig.windows64.h"
+#endif
+
+#ifdef ARCH_WINDOWS32
+  #include "orconfig.windows32.h"
+#endif
+
+#ifdef ARCH_FREEBSD64
+  #include "orconfig.freebsd64.h"
+#endif
+
+#ifdef ARCH_OPENBSD64
+  #include "orconfig.openbsd64.h"
+#endif
+
+#ifdef ARCH_NETBSD64
+  #include "orconfig.netbsd64.h"
+#endif
+
+/* zstd is vendored and wrapped along with Tor, enabled by the zstd preamble */
+#ifdef LIBTOR_ZSTD
+  #define HAVE_ZSTD 1
+  #define HAVE_ZSTD_ESTIMATECSTREAMSIZE 1
+  #define HAVE_ZSTD_ESTIMATEDCTXSIZE 1
+#endif
+
+/* liblzma is only vendored with --with-lzma, enabled by the lzma preamble */
+#ifdef LIBTOR_LZMA
+  #define HAVE_LZMA 1
+#endif
+
+/* The relay and dirauth modules are left out of client only builds */
+#ifdef LIBTOR_CLIENT_ONLY
+  #undef HAVE_MODULE_RELAY
+  #undef HAVE_MODULE_DIRAUTH
+  #undef HAVE_MODULE_DIRCACHE
+#endif
+
+/* GPL licensed code is only allowed with --enable-gpl, enabled by the preamble */
+#ifdef LIBTOR_GPL
+  #define ENABLE_GPL 1
+#endif
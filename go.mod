@@ -1,9 +1,11 @@
 module github.com/ooni/go-libtor
 
-go 1.13
+go 1.16
 
 require (
 	github.com/cretz/bine v0.1.0
 	github.com/stretchr/testify v1.3.0 // indirect
 	golang.org/x/crypto v0.0.0-20190404164418-38d8ce5564a5 // indirect
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 )
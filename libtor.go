@@ -6,6 +6,9 @@ package libtor
 // the way of the repo root.
 
 import (
+	"context"
+	"net"
+
 	"github.com/cretz/bine/process"
 
 	"github.com/ooni/go-libtor/libtor"
@@ -17,9 +20,233 @@ func ProviderVersion() string {
 	return libtor.ProviderVersion()
 }
 
+// Versions returns the versions of the libraries wrapped into the embedded Tor:
+// zlib (or zlib-ng), zstd, libevent, openssl, tor and lzma if vendored.
+func Versions() map[string]string {
+	return libtor.Versions()
+}
+
+// TorConfig is a configuration for an embedded Tor instance, wrapping the C API
+// tor_main_configuration_t one-to-one. It must be freed when not needed any more.
+type TorConfig = libtor.TorConfig
+
+// NewConfig creates a new, empty embedded Tor configuration.
+func NewConfig() (*TorConfig, error) {
+	return libtor.NewConfig()
+}
+
+// Run starts an embedded Tor instance with the given configuration and blocks
+// until it terminates, returning its exit code. If another Tor is already running
+// in the process, TorExitBusy is returned without starting it.
+func Run(cfg *TorConfig) int {
+	return libtor.Run(cfg)
+}
+
+// RunTor starts an embedded Tor instance with the given command line arguments
+// and blocks until it terminates. A non-zero exit code is returned as a
+// *TorExitError.
+//
+// If the context is cancelled, Tor is asked to shut down cleanly via its owning
+// control socket and RunTor returns the context's error once it exited. If Tor
+// is already running in the process, ErrAlreadyRunning is returned.
+func RunTor(ctx context.Context, args ...string) error {
+	return libtor.RunTor(ctx, args...)
+}
+
+// RunTorConfig starts an embedded Tor instance with the given typed configuration
+// and blocks until it terminates. A non-zero exit code is returned as a
+// *TorExitError.
+//
+// If the context is cancelled, Tor is asked to shut down gracefully and halted if
+// it doesn't exit within Config.ShutdownTimeout.
+func RunTorConfig(ctx context.Context, conf *Config) error {
+	return libtor.RunTorConfig(ctx, conf)
+}
+
+// VerifyError is returned by VerifyConfig if Tor rejects the configuration.
+type VerifyError = libtor.VerifyError
+
+// VerifyConfig checks whether Tor accepts the given command line arguments by
+// running it with --verify-config, without starting it. A Tor started afterwards
+// is a restart within the process (Tor bug 23847).
+func VerifyConfig(args ...string) error {
+	return libtor.VerifyConfig(args...)
+}
+
+// SelfTest checks that the embedded Tor is functional by running it with
+// --verify-config on a throwaway configuration, to detect a broken build early.
+// The Tor started afterwards is a restart within the process (Tor bug 23847).
+func SelfTest() error {
+	return libtor.SelfTest()
+}
+
+// AddEntropy mixes the given seed into the random number generator used by Tor,
+// supplementing (never replacing) the randomness of the operating system.
+func AddEntropy(seed []byte) {
+	libtor.AddEntropy(seed)
+}
+
+// RNGError is returned when the random number generator Tor draws its keys from
+// could not be seeded securely from the operating system.
+type RNGError = libtor.RNGError
+
+// CheckRNG verifies that the random number generator Tor uses for all its key
+// material is securely seeded from the operating system.
+func CheckRNG() error {
+	return libtor.CheckRNG()
+}
+
+// WriteGeoIPFiles writes the embedded IPv4 and IPv6 GeoIP databases of Tor into
+// dir, returning their paths to pass via GeoIPFile and GeoIPv6File.
+func WriteGeoIPFiles(dir string) (geoip, geoip6 string, err error) {
+	return libtor.WriteGeoIPFiles(dir)
+}
+
+// ErrNoGeoIP is returned when the GeoIP databases were not embedded into the
+// library.
+var ErrNoGeoIP = libtor.ErrNoGeoIP
+
+// ErrAlreadyRunning is returned when trying to start an embedded Tor while one
+// is already running in the process. Tor keeps its state in process globals, so
+// it can't run more than one instance at a time.
+var ErrAlreadyRunning = libtor.ErrAlreadyRunning
+
+// ErrDataDirLocked is returned by Start if the data folder is in use by another
+// Tor, be it another process or one started via RunTor in this process.
+var ErrDataDirLocked = libtor.ErrDataDirLocked
+
+// Known exit codes of the embedded Tor, carried by TorExitError.
+const (
+	TorExitStartup = libtor.TorExitStartup // Invalid configuration or failed startup
+	TorExitFatal   = libtor.TorExitFatal   // Died while running
+	TorExitBusy    = libtor.TorExitBusy    // Not started by Run, another Tor is running
+)
+
+// TorExitError is returned when the embedded Tor exits with a non-zero code.
+type TorExitError = libtor.TorExitError
+
+// ControlConn is a connection speaking Tor's control protocol, taking care of the
+// framing of the replies and separating asynchronous events from them.
+type ControlConn = libtor.ControlConn
+
+// NewControlConn wraps a connection to Tor's control port (or socket) into a
+// control protocol client.
+func NewControlConn(conn net.Conn) *ControlConn {
+	return libtor.NewControlConn(conn)
+}
+
+// ConfError is returned when Tor rejects a configuration change or lookup made
+// via a ControlConn.
+type ConfError = libtor.ConfError
+
+// Circuit is the state of a circuit built (or being built) by Tor.
+type Circuit = libtor.Circuit
+
+// Stream is the state of an application stream attached (or to be attached) to
+// a circuit.
+type Stream = libtor.Stream
+
+// HashControlPassword hashes a control port password the same way as
+// tor --hash-password, for Tor's HashedControlPassword option.
+func HashControlPassword(password string) (string, error) {
+	return libtor.HashControlPassword(password)
+}
+
 // Available is true if this target is supported.
 const Available = true
 
 // Creator implements the bine.process.Creator, permitting libtor to act as an API
 // backend for the bine/tor Go interface.
 var Creator process.Creator = libtor.Creator
+
+// Config is a set of typed Tor options used to start an embedded Instance.
+type Config = libtor.Config
+
+// Instance is a running embedded Tor, along with an authenticated controller
+// connection to it.
+type Instance = libtor.Instance
+
+// NewInstance validates the configuration and starts a new embedded Tor with it,
+// returning once the controller connection is authenticated.
+func NewInstance(ctx context.Context, conf *Config) (*Instance, error) {
+	return libtor.NewInstance(ctx, conf)
+}
+
+// StartConf is the configuration to start an embedded Tor with.
+type StartConf = libtor.StartConf
+
+// Tor is an embedded Tor running in-process, along with the owning controller
+// connection to it.
+type Tor = libtor.Tor
+
+// Start launches an embedded Tor in a background goroutine and waits for it to
+// bootstrap, returning once it's able to build circuits.
+func Start(ctx context.Context, conf *StartConf) (*Tor, error) {
+	return libtor.Start(ctx, conf)
+}
+
+// BootstrapStatus is a bootstrap progress report of Tor.
+type BootstrapStatus = libtor.BootstrapStatus
+
+// BootstrapError is returned by Start if its context ends before Tor finished
+// bootstrapping, or Tor reports a bootstrap failure, reporting the last progress.
+type BootstrapError = libtor.BootstrapError
+
+// BootstrapDiagnostics is a snapshot of what Tor reports about its connection to
+// the network, to make sense of a stuck or failed bootstrap.
+type BootstrapDiagnostics = libtor.BootstrapDiagnostics
+
+// Heartbeat is the summary of uptime, circuits and traffic Tor logs periodically.
+type Heartbeat = libtor.Heartbeat
+
+// ClientStatus is a client status event (STATUS_CLIENT) reported by Tor.
+type ClientStatus = libtor.ClientStatus
+
+// NewIdentityRateLimit is the minimum interval Tor enforces between two fresh
+// identities.
+const NewIdentityRateLimit = libtor.NewIdentityRateLimit
+
+// ErrNewIdentityRateLimited is returned by NewIdentity if the request came within
+// NewIdentityRateLimit of the previous one, Tor delaying it.
+var ErrNewIdentityRateLimited = libtor.ErrNewIdentityRateLimited
+
+// ClientTransport is the client side of a pluggable transport (e.g. obfs4) run
+// in-process, next to the embedded Tor.
+type ClientTransport = libtor.ClientTransport
+
+// TransportLauncher is implemented by ClientTransports needing to be set up before
+// use and torn down afterwards.
+type TransportLauncher = libtor.TransportLauncher
+
+// TransportEnv is the environment of a pluggable transport, the in-process
+// counterpart of the TOR_PT_* variables of managed transports.
+type TransportEnv = libtor.TransportEnv
+
+// ServeManagedTransports runs the process as a managed pluggable transport if it
+// was launched as one by Tor, returning false straight away otherwise.
+func ServeManagedTransports(transports map[string]ClientTransport) (bool, error) {
+	return libtor.ServeManagedTransports(transports)
+}
+
+// ConsensusStatus describes how current the embedded Tor's view of the network is.
+type ConsensusStatus = libtor.ConsensusStatus
+
+// OnionConf is the configuration of an onion service to create.
+type OnionConf = libtor.OnionConf
+
+// Onion is an onion service published by the embedded Tor.
+type Onion = libtor.Onion
+
+// OnionDescEvent is a step in the lifecycle of a descriptor of an onion service.
+type OnionDescEvent = libtor.OnionDescEvent
+
+// OnionClientAuth is the client authorization credential of a v3 onion service.
+type OnionClientAuth = libtor.OnionClientAuth
+
+// OnionAuthError is returned when Tor rejects an onion client authorization
+// command.
+type OnionAuthError = libtor.OnionAuthError
+
+// ErrOnionAuthNotFound is returned when removing the client authorization of an
+// onion service that has none registered.
+var ErrOnionAuthNotFound = libtor.ErrOnionAuthNotFound
@@ -11,3 +11,7 @@ package libtor
 #cgo CFLAGS: -I${SRCDIR}/../darwin/libevent/include
 */
 import "C"
+
+func init() {
+	wrappedVersions["libevent"] = "2.2.1-alpha-dev"
+}
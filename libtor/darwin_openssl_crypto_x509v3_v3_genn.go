@@ -1,6 +1,7 @@
 // go-libtor - Self-contained Tor from Go
 // Copyright (c) 2018 Péter Szilágyi. All rights reserved.
 // +build darwin,amd64 darwin,arm64 ios,amd64 ios,arm64
+// +build !system_openssl
 
 package libtor
 
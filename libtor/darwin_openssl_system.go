@@ -0,0 +1,18 @@
+// go-libtor - Self-contained Tor from Go
+// Copyright (c) 2018 Péter Szilágyi. All rights reserved.
+// +build darwin,amd64 darwin,arm64 ios,amd64 ios,arm64
+// +build system_openssl
+
+package libtor
+
+/*
+#cgo pkg-config: libssl libcrypto
+
+#include <openssl/crypto.h>
+*/
+import "C"
+
+// The system OpenSSL is linked at runtime, so its version is only known then
+func init() {
+	wrappedVersions["openssl"] = C.GoString(C.OpenSSL_version(C.OPENSSL_VERSION))
+}
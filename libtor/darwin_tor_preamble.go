@@ -18,3 +18,7 @@ package libtor
 #cgo LDFLAGS: -lm
 */
 import "C"
+
+func init() {
+	wrappedVersions["tor"] = "0.4.7.13-dev"
+}
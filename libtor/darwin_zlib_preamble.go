@@ -10,3 +10,7 @@ package libtor
 #cgo CFLAGS: -DHAVE_UNISTD_H -DHAVE_STDARG_H
 */
 import "C"
+
+func init() {
+	wrappedVersions["zlib"] = "1.2.13"
+}
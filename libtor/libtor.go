@@ -25,18 +25,365 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/cretz/bine/process"
 )
 
+// ErrAlreadyRunning is returned when trying to start an embedded Tor while one
+// is already running (or still shutting down) in the process. Tor keeps its state
+// in process globals (the options, the event loop, the connection and circuit
+// tables, etc), so it can't run more than one instance at a time. Separate
+// instances (e.g. for isolating tenants) need separate processes; within one Tor,
+// use stream isolation.
+var ErrAlreadyRunning = errors.New("embedded tor already running in this process")
+
+// Known exit codes of the embedded Tor (tor_run_main), carried by TorExitError.
+const (
+	// TorExitStartup is returned if Tor failed to start: the configuration or
+	// command line is invalid, or acting on it failed (e.g. the data folder is
+	// not accessible or a listener port is taken). Retrying with the same
+	// configuration is pointless.
+	TorExitStartup = -1
+
+	// TorExitFatal is returned if Tor died while running, after getting into a
+	// broken state, e.g. failing to act on a reloaded configuration.
+	TorExitFatal = 1
+
+	// TorExitBusy is returned by Run (never by Tor itself) if another Tor is
+	// already running in the process and it wasn't started. Unlike a startup
+	// failure, the same configuration may work once the running one exited.
+	TorExitBusy = -2
+)
+
+// TorExitError is returned when the embedded Tor exits with a non-zero code, see
+// TorExitStartup and TorExitFatal for the known ones. A clean stop (e.g. via
+// SIGNAL SHUTDOWN) exits with zero and is not an error.
+type TorExitError struct {
+	Code int // Exit code returned by tor_run_main
+}
+
+// Error implements error, reporting the exit code.
+func (e *TorExitError) Error() string {
+	switch e.Code {
+	case TorExitStartup:
+		return "embedded tor failed to start (exit code -1)"
+	case TorExitFatal:
+		return "embedded tor died (exit code 1)"
+	default:
+		return fmt.Sprintf("embedded tor failed: %d", e.Code)
+	}
+}
+
+// States of the embedded Tor, guarding tor_run_main against concurrent runs. The
+// transitions are atomic: idle -> starting (acquire) -> running -> stopping
+// (runMain) -> idle (release), or starting -> idle if it's never run.
+const (
+	torIdle     int32 = iota // No embedded Tor, one may be started
+	torStarting              // Reserved by acquire, being set up
+	torRunning               // Inside tor_run_main
+	torStopping              // Returned from tor_run_main, not yet released
+)
+
+// torState is the current state of the embedded Tor.
+var torState = torIdle
+
+// acquire reserves the right to run the embedded Tor, failing if it's already
+// reserved, running or still winding down. It must be paired with a release once
+// tor_run_main returns (or if it's never called).
+func acquire() error {
+	if !atomic.CompareAndSwapInt32(&torState, torIdle, torStarting) {
+		return ErrAlreadyRunning
+	}
+	return nil
+}
+
+// release allows the embedded Tor to be run again. It's a noop while Tor is
+// inside tor_run_main, so a stray release can never let a second one in.
+func release() {
+	if !atomic.CompareAndSwapInt32(&torState, torStopping, torIdle) {
+		atomic.CompareAndSwapInt32(&torState, torStarting, torIdle)
+	}
+}
+
 // ProviderVersion returns the Tor provider name and version exposed from the
 // Tor embedded API.
 func ProviderVersion() string {
 	return C.GoString(C.tor_api_get_provider_version())
 }
 
+// wrappedVersions are the versions of the wrapped libraries, registered by the
+// generated preambles of the current target, keyed by library name.
+var wrappedVersions = make(map[string]string)
+
+// Versions returns the versions of the libraries wrapped into the embedded Tor:
+// zlib (or zlib-ng), zstd, libevent, openssl, tor and lzma if vendored. These are
+// the upstream versions captured when the sources were wrapped, so retrieving
+// them needs no calls into C. Libraries not wrapped for the current target are
+// missing from the map.
+func Versions() map[string]string {
+	versions := make(map[string]string, len(wrappedVersions))
+	for lib, version := range wrappedVersions {
+		versions[lib] = version
+	}
+	return versions
+}
+
+// TorConfig is a configuration for an embedded Tor instance, wrapping the C API
+// tor_main_configuration_t one-to-one. It must be freed when not needed any more.
+type TorConfig struct {
+	conf *C.struct_tor_main_configuration_t
+
+	argv **C.char // Command line set on the configuration, owned by Go
+	argc C.int    // Number of arguments in the command line
+}
+
+// NewConfig creates a new, empty embedded Tor configuration
+// (tor_main_configuration_new).
+func NewConfig() (*TorConfig, error) {
+	conf := C.tor_main_configuration_new()
+	if conf == nil {
+		return nil, errors.New("failed to create tor configuration")
+	}
+	return &TorConfig{conf: conf}, nil
+}
+
+// SetCommandLine sets the command line arguments to run Tor with
+// (tor_main_configuration_set_command_line). The arguments should not contain
+// the program name, that is injected automatically.
+func (c *TorConfig) SetCommandLine(args []string) error {
+	if c.conf == nil {
+		return errors.New("tor configuration already freed")
+	}
+	// Create the char array for the args
+	args = append([]string{"tor"}, args...)
+
+	argv := C.makeCharArray(C.int(len(args)))
+	for i, a := range args {
+		C.setArrayString(argv, C.CString(a), C.int(i))
+	}
+	if code := C.tor_main_configuration_set_command_line(c.conf, C.int(len(args)), argv); code != 0 {
+		C.freeCharArray(argv, C.int(len(args)))
+		return fmt.Errorf("failed to set arguments: %v", int(code))
+	}
+	// Tor references the array without copying, replace any previous one
+	if c.argv != nil {
+		C.freeCharArray(c.argv, c.argc)
+	}
+	c.argv, c.argc = argv, C.int(len(args))
+	return nil
+}
+
+// ControlSocket sets up an owning control socket for the embedded Tor to speak
+// the control protocol on (tor_main_configuration_setup_control_socket) and
+// returns the controller side of it. The connection is already authenticated,
+// so commands such as GETINFO can be sent right away. Tor exits when it's closed.
+// Under the hood, Tor is told about it with __OwningControllerFD, so that option
+// must not be set on the command line too.
+//
+// ControlSocket must be called before Run, and only once per configuration.
+func (c *TorConfig) ControlSocket() (net.Conn, error) {
+	if c.conf == nil {
+		return nil, errors.New("tor configuration already freed")
+	}
+	fd := C.tor_main_configuration_setup_control_socket(c.conf)
+	if fd == C.INVALID_TOR_CONTROL_SOCKET {
+		return nil, errors.New("unable to create control socket")
+	}
+	file := os.NewFile(uintptr(fd), "")
+	defer file.Close()
+
+	conn, err := net.FileConn(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create control socket: %v", err)
+	}
+	return conn, nil
+}
+
+// Free releases all the resources held by the configuration
+// (tor_main_configuration_free). It must not be called while Tor is running
+// with it. Calling Free multiple times is a noop.
+func (c *TorConfig) Free() {
+	if c.conf != nil {
+		C.tor_main_configuration_free(c.conf)
+		c.conf = nil
+	}
+	if c.argv != nil {
+		C.freeCharArray(c.argv, c.argc)
+		c.argv, c.argc = nil, 0
+	}
+}
+
+// Run starts an embedded Tor instance with the given configuration and blocks
+// until it terminates, returning its exit code (tor_run_main). If another Tor
+// is already running in the process, TorExitBusy is returned without starting
+// it.
+func Run(cfg *TorConfig) int {
+	if err := acquire(); err != nil {
+		return TorExitBusy
+	}
+	defer release()
+
+	return runMain(cfg)
+}
+
+// runMain runs the embedded Tor (tor_run_main), the caller having acquired the
+// right to do so. The caller must release it once done with the configuration.
+func runMain(cfg *TorConfig) int {
+	if cfg.conf == nil {
+		return -1
+	}
+	if !atomic.CompareAndSwapInt32(&torState, torStarting, torRunning) {
+		return -1
+	}
+	defer atomic.StoreInt32(&torState, torStopping)
+
+	return int(C.tor_run_main(cfg.conf))
+}
+
+// RunTor starts an embedded Tor instance with the given command line arguments
+// and blocks until it terminates. A non-zero exit code is returned as a
+// *TorExitError.
+//
+// If the context is cancelled, Tor is asked to shut down cleanly via its owning
+// control socket and RunTor returns the context's error once it exited. If Tor
+// is already running in the process, ErrAlreadyRunning is returned.
+func RunTor(ctx context.Context, args ...string) error {
+	return RunTorConfig(ctx, &Config{ExtraArgs: args})
+}
+
+// RunTorConfig starts an embedded Tor instance with the given typed configuration
+// and blocks until it terminates. A non-zero exit code is returned as a
+// *TorExitError.
+//
+// If the context is cancelled, Tor is asked to shut down gracefully via its owning
+// control socket (SIGNAL SHUTDOWN), so onion services can tear down their state.
+// If it doesn't exit within Config.ShutdownTimeout, it's halted. RunTorConfig
+// returns the context's error once Tor exited.
+func RunTorConfig(ctx context.Context, conf *Config) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if conf == nil {
+		conf = new(Config)
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	if err := seedRNG(conf); err != nil {
+		return err
+	}
+	if err := acquire(); err != nil {
+		return err
+	}
+	defer release()
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return err
+	}
+	defer cfg.Free()
+
+	// Build the tor configuration, along with an owning controller to stop it
+	if err := cfg.SetCommandLine(conf.Args()); err != nil {
+		return err
+	}
+	control, err := cfg.ControlSocket()
+	if err != nil {
+		return err
+	}
+	defer control.Close()
+
+	// Run tor until it terminates or we're requested to stop it
+	done := make(chan int, 1)
+	go func() {
+		done <- runMain(cfg)
+	}()
+	select {
+	case code := <-done:
+		if code != 0 {
+			return &TorExitError{Code: code}
+		}
+		return nil
+
+	case <-ctx.Done():
+		// The owning controller is pre-authenticated, just request a shutdown
+		control.Write([]byte("SIGNAL SHUTDOWN\r\n"))
+
+		select {
+		case <-done:
+		case <-time.After(conf.shutdownTimeout()):
+			// Graceful shutdown timed out, halt and drop the owning controller
+			control.Write([]byte("SIGNAL HALT\r\n"))
+			control.Close()
+			<-done
+		}
+		return ctx.Err()
+	}
+}
+
+// SelfTest checks that the embedded Tor is functional, e.g. to detect a broken
+// build (such as one wrapped from partially generated sources) when the app
+// starts rather than on its first connection. It checks that OpenSSL's random
+// number generator is seeded and runs Tor with --verify-config on a throwaway
+// configuration, which sets up its subsystems and parses the options without
+// touching the network. A non-zero exit is returned as a *TorExitError, a Go
+// panic during the test as an error. If Tor is already running in the process,
+// ErrAlreadyRunning is returned, as the running one proves the point anyway.
+//
+// The check has two limits. First, the Tor started afterwards is the second
+// tor_run_main in this process, which upstream warns might misbehave (Tor bug
+// 23847, see the restart caveat under "One Tor per process" in the README).
+// Second, only Go panics are recovered: a broken build that makes the C code
+// abort or crash still takes the whole process down.
+func SelfTest() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("embedded tor self-test panicked: %v", r)
+		}
+	}()
+	if ProviderVersion() == "" {
+		return errors.New("embedded tor reports no version")
+	}
+	if err := CheckRNG(); err != nil {
+		return err
+	}
+	if err := acquire(); err != nil {
+		return err
+	}
+	defer release()
+
+	dir, err := ioutil.TempDir("", "libtor-selftest-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return err
+	}
+	defer cfg.Free()
+
+	if err := cfg.SetCommandLine([]string{
+		"--verify-config", "--quiet",
+		"-f", filepath.Join(dir, "torrc"), "--ignore-missing-torrc",
+		"--DataDirectory", dir,
+		"--SocksPort", "auto",
+	}); err != nil {
+		return err
+	}
+	if code := runMain(cfg); code != 0 {
+		return &TorExitError{Code: code}
+	}
+	return nil
+}
+
 // Creator implements the bine.process.Creator, permitting libtor to act as an API
 // backend for the bine/tor Go interface.
 var Creator process.Creator = new(embeddedCreator)
@@ -50,9 +397,13 @@ func (embeddedCreator) New(ctx context.Context, args ...string) (process.Process
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	conf, err := NewConfig()
+	if err != nil {
+		return nil, err
+	}
 	return &embeddedProcess{
 		ctx:  ctx,
-		conf: C.tor_main_configuration_new(),
+		conf: conf,
 		args: args,
 	}, nil
 }
@@ -61,7 +412,7 @@ func (embeddedCreator) New(ctx context.Context, args ...string) (process.Process
 // backend for the bine/tor Go interface.
 type embeddedProcess struct {
 	ctx  context.Context
-	conf *C.struct_tor_main_configuration_t
+	conf *TorConfig
 	args []string
 	done chan int
 }
@@ -71,25 +422,22 @@ func (e *embeddedProcess) Start() error {
 	if e.done != nil {
 		return errors.New("already started")
 	}
-	// Create the char array for the args
-	args := append([]string{"tor"}, e.args...)
-
-	charArray := C.makeCharArray(C.int(len(args)))
-	for i, a := range args {
-		C.setArrayString(charArray, C.CString(a), C.int(i))
+	if err := acquire(); err != nil {
+		return err
 	}
 	// Build the tor configuration
-	if code := C.tor_main_configuration_set_command_line(e.conf, C.int(len(args)), charArray); code != 0 {
-		C.tor_main_configuration_free(e.conf)
-		C.freeCharArray(charArray, C.int(len(args)))
-		return fmt.Errorf("failed to set arguments: %v", int(code))
+	if err := e.conf.SetCommandLine(e.args); err != nil {
+		e.conf.Free()
+		release()
+		return err
 	}
 	// Start tor and return
 	e.done = make(chan int, 1)
 	go func() {
-		defer C.freeCharArray(charArray, C.int(len(args)))
-		defer C.tor_main_configuration_free(e.conf)
-		e.done <- int(C.tor_run_main(e.conf))
+		code := runMain(e.conf)
+		e.conf.Free()
+		release()
+		e.done <- code
 	}()
 	return nil
 }
@@ -107,17 +455,12 @@ func (e *embeddedProcess) Wait() error {
 		if code == 0 {
 			return nil
 		}
-		return fmt.Errorf("embedded tor failed: %v", code)
+		return &TorExitError{Code: code}
 	}
 }
 
 // EmbeddedControlConn implements process.Process, connecting to the control port
 // of the embedded Tor isntance.
 func (e *embeddedProcess) EmbeddedControlConn() (net.Conn, error) {
-	file := os.NewFile(uintptr(C.tor_main_configuration_setup_control_socket(e.conf)), "")
-	conn, err := net.FileConn(file)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create control socket: %v", err)
-	}
-	return conn, nil
+	return e.conf.ControlSocket()
 }
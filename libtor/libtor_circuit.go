@@ -0,0 +1,221 @@
+package libtor
+
+// This file contains the circuit and stream introspection of the control client,
+// parsing both the GETINFO listings and the asynchronous CIRC and STREAM events.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Circuit is the state of a circuit built (or being built) by Tor, as reported by
+// GETINFO circuit-status or a CIRC event.
+type Circuit struct {
+	ID     string // Identifier of the circuit, unique within the Tor instance
+	Status string // LAUNCHED, BUILT, GUARD_WAIT, EXTENDED, FAILED or CLOSED
+
+	Path       []string // Fingerprints of the relays, from the first hop onwards
+	Nicknames  []string // Nicknames of the relays in Path, empty where unknown
+	BuildFlags []string // Flags the circuit was built with (e.g. IS_INTERNAL)
+	Purpose    string   // Purpose of the circuit (e.g. GENERAL, HS_CLIENT_REND)
+	Reason     string   // Reason a FAILED or CLOSED circuit ended, if any
+}
+
+// Stream is the state of an application stream attached (or to be attached) to
+// a circuit, as reported by GETINFO stream-status or a STREAM event.
+type Stream struct {
+	ID        string // Identifier of the stream, unique within the Tor instance
+	Status    string // NEW, SENTCONNECT, SUCCEEDED, FAILED, CLOSED, DETACHED, ...
+	CircuitID string // Circuit the stream is attached to, "0" if none yet
+	Target    string // Destination of the stream as host:port
+	Purpose   string // Purpose of the stream (e.g. USER, DIR_FETCH), if reported
+	Reason    string // Reason a FAILED or CLOSED stream ended, if any
+}
+
+// Circuits lists the circuits currently known to Tor (GETINFO circuit-status).
+func (c *ControlConn) Circuits() ([]*Circuit, error) {
+	lines, err := c.getInfoLines("circuit-status")
+	if err != nil {
+		return nil, err
+	}
+	circuits := make([]*Circuit, 0, len(lines))
+	for _, line := range lines {
+		circuit, err := parseCircuit(line)
+		if err != nil {
+			return nil, err
+		}
+		circuits = append(circuits, circuit)
+	}
+	return circuits, nil
+}
+
+// Streams lists the streams currently known to Tor (GETINFO stream-status).
+func (c *ControlConn) Streams() ([]*Stream, error) {
+	lines, err := c.getInfoLines("stream-status")
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]*Stream, 0, len(lines))
+	for _, line := range lines {
+		stream, err := parseStream(line)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// CircuitEvents returns the channel the CIRC events are delivered on, parsed.
+// They need to be subscribed to via SetEvents, and are delivered on the Events
+// channel in their raw form too. Like those, they are dropped, keeping the
+// latest ones, if the channel is not drained fast enough.
+func (c *ControlConn) CircuitEvents() <-chan *Circuit {
+	return c.circuits
+}
+
+// StreamEvents returns the channel the STREAM events are delivered on, parsed,
+// with the same semantics as CircuitEvents.
+func (c *ControlConn) StreamEvents() <-chan *Stream {
+	return c.streams
+}
+
+// getInfoLines retrieves a GETINFO key holding one entry per line, such as the
+// circuit or stream listings, dropping the empty ones.
+func (c *ControlConn) getInfoLines(key string) ([]string, error) {
+	values, err := c.GetInfo(key)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(values[key], "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// parseCircuit parses a circuit entry of the form:
+//
+//	CircuitID CircStatus [Path] [BUILD_FLAGS=...] [PURPOSE=...] [REASON=...] ...
+//
+// where the path is a comma separated list of $fingerprint~nickname entries.
+func parseCircuit(line string) (*Circuit, error) {
+	fields := splitControlFields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed circuit status: %q", line)
+	}
+	circuit := &Circuit{ID: fields[0], Status: fields[1]}
+
+	rest := fields[2:]
+	if len(rest) > 0 && !controlKeywordRegexp.MatchString(rest[0]) {
+		for _, hop := range strings.Split(rest[0], ",") {
+			fingerprint, nickname := splitLongName(hop)
+			circuit.Path = append(circuit.Path, fingerprint)
+			circuit.Nicknames = append(circuit.Nicknames, nickname)
+		}
+		rest = rest[1:]
+	}
+	for key, value := range controlKeywords(rest) {
+		switch key {
+		case "BUILD_FLAGS":
+			circuit.BuildFlags = strings.Split(value, ",")
+		case "PURPOSE":
+			circuit.Purpose = value
+		case "REASON":
+			circuit.Reason = value
+		}
+	}
+	return circuit, nil
+}
+
+// parseStream parses a stream entry of the form:
+//
+//	StreamID StreamStatus CircuitID Target [REASON=...] [PURPOSE=...] ...
+func parseStream(line string) (*Stream, error) {
+	fields := splitControlFields(line)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("malformed stream status: %q", line)
+	}
+	stream := &Stream{ID: fields[0], Status: fields[1], CircuitID: fields[2], Target: fields[3]}
+
+	for key, value := range controlKeywords(fields[4:]) {
+		switch key {
+		case "PURPOSE":
+			stream.Purpose = value
+		case "REASON":
+			stream.Reason = value
+		}
+	}
+	return stream, nil
+}
+
+// controlKeywordRegexp matches the KEYWORD=value arguments of replies and events.
+var controlKeywordRegexp = regexp.MustCompile(`^[A-Z_]+=`)
+
+// controlKeywords collects the KEYWORD=value arguments of a reply or event,
+// unquoting the quoted values.
+func controlKeywords(fields []string) map[string]string {
+	keywords := make(map[string]string)
+	for _, field := range fields {
+		if !controlKeywordRegexp.MatchString(field) {
+			continue
+		}
+		eq := strings.IndexByte(field, '=')
+		keywords[field[:eq]] = unquoteControl(field[eq+1:])
+	}
+	return keywords
+}
+
+// splitLongName splits a relay reference ($fingerprint~nickname, with = instead
+// of ~ for named relays) into the fingerprint and the (optional) nickname.
+func splitLongName(name string) (string, string) {
+	name = strings.TrimPrefix(name, "$")
+	if sep := strings.IndexAny(name, "~="); sep >= 0 {
+		return name[:sep], name[sep+1:]
+	}
+	return name, ""
+}
+
+// splitControlFields splits a reply or event line on spaces, keeping the quoted
+// strings (which may contain escaped quotes and spaces) intact.
+func splitControlFields(line string) []string {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '\\' && quoted && i+1 < len(line):
+			field.WriteByte(ch)
+			field.WriteByte(line[i+1])
+			i++
+		case ch == '"':
+			quoted = !quoted
+			field.WriteByte(ch)
+		case ch == ' ' && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteByte(ch)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// unquoteControl strips the quotes and escapes of a quoted control value, leaving
+// unquoted ones untouched.
+func unquoteControl(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value[1 : len(value)-1])
+}
@@ -0,0 +1,175 @@
+package libtor
+
+// This file contains the typed configuration surface of the embedded Tor. Every
+// field maps to one (or a handful) of torrc directives, which are passed to Tor
+// as command line arguments when an Instance is started.
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// defaultShutdownTimeout is the time Tor is given to shut down gracefully before
+// it's halted, if the configuration doesn't specify one.
+const defaultShutdownTimeout = 30 * time.Second
+
+// Config is a set of typed Tor options used to start an embedded Instance. The
+// zero value is a valid configuration, keeping Tor's defaults for everything.
+type Config struct {
+	// VirtualAddrNetworkIPv4 is the IPv4 network (in CIDR notation) Tor hands
+	// out virtual addresses from for MAPADDRESS and automapped hosts. If empty,
+	// Tor's default of 127.192.0.0/10 is used.
+	VirtualAddrNetworkIPv4 string
+
+	// VirtualAddrNetworkIPv6 is the IPv6 network (in CIDR notation) Tor hands
+	// out virtual addresses from for MAPADDRESS and automapped hosts. If empty,
+	// Tor's default of [FE80::]/10 is used.
+	VirtualAddrNetworkIPv6 string
+
+	// AutomapHostsOnResolve, if set, makes Tor answer DNS requests for hosts
+	// with a suffix in AutomapHostsSuffixes (.onion and .exit by default) with
+	// a virtual address from the above networks. This is the basis for
+	// transparently proxying applications through Tor.
+	AutomapHostsOnResolve bool
+
+	// LogLevel is the minimum severity of the messages written to LogFile and to
+	// syslog (debug, info, notice, warn or err). If empty, notice is used.
+	LogLevel string
+
+	// LogFile is the path of a file Tor should append its logs to. The folder
+	// containing it must exist and be writable. Tor itself doesn't rotate the
+	// file, but it reopens it on SIGNAL RELOAD (HUP), so the usual external
+	// rotation tools can be used.
+	LogFile string
+
+	// LogSyslog, if set, makes Tor send its logs to the system logger.
+	LogSyslog bool
+
+	// OwningControllerProcess is the PID of a process Tor should exit with. Tor
+	// polls it and shuts down once the process is gone, which is useful when the
+	// embedding program is itself supervised (e.g. pass os.Getppid() in a helper
+	// binary). If zero, Tor doesn't follow any process.
+	//
+	// There is no equivalent for file descriptors: the owning control socket of
+	// TorConfig.ControlSocket is already passed to Tor as __OwningControllerFD,
+	// so Tor exits as soon as the Go side of it is closed, be it explicitly or by
+	// the process dying. Setting __OwningControllerFD via ExtraArgs conflicts.
+	OwningControllerProcess int
+
+	// ShutdownTimeout is the time Tor is given to exit after being asked to shut
+	// down gracefully (SIGNAL SHUTDOWN), when its context is cancelled or it's
+	// closed. Afterwards it's halted by dropping its owning control socket. If
+	// zero, 30 seconds are used. This is not a Tor option, see ShutdownWaitLength
+	// for how long a relay itself waits for its connections to drain.
+	ShutdownTimeout time.Duration
+
+	// Entropy is extra randomness mixed into the random number generator before
+	// Tor starts (see AddEntropy), for devices booting with a starved OS RNG.
+	// It's not a Tor option, and it only supplements the OS RNG: Tor refuses to
+	// start with an *RNGError if the latter can't seed it.
+	Entropy []byte
+
+	// ExtraArgs is a list of raw command line arguments appended after the ones
+	// generated from the typed fields.
+	ExtraArgs []string
+}
+
+// Validate checks that the configuration is something Tor will accept, so any
+// mistakes surface as a Go error instead of a failed Tor startup.
+func (c *Config) Validate() error {
+	if c.VirtualAddrNetworkIPv4 != "" {
+		ip, network, err := net.ParseCIDR(c.VirtualAddrNetworkIPv4)
+		if err != nil {
+			return fmt.Errorf("invalid VirtualAddrNetworkIPv4: %v", err)
+		}
+		if ip.To4() == nil {
+			return errors.New("invalid VirtualAddrNetworkIPv4: not an IPv4 network")
+		}
+		// Tor needs at least 16 bits of address space to allocate from
+		if bits, _ := network.Mask.Size(); bits > 16 {
+			return fmt.Errorf("invalid VirtualAddrNetworkIPv4: /%d is too small, need /16 or larger", bits)
+		}
+	}
+	if c.VirtualAddrNetworkIPv6 != "" {
+		ip, network, err := net.ParseCIDR(c.VirtualAddrNetworkIPv6)
+		if err != nil {
+			return fmt.Errorf("invalid VirtualAddrNetworkIPv6: %v", err)
+		}
+		if ip.To4() != nil {
+			return errors.New("invalid VirtualAddrNetworkIPv6: not an IPv6 network")
+		}
+		// Tor needs at least 24 bits of address space to allocate from
+		if bits, _ := network.Mask.Size(); bits > 104 {
+			return fmt.Errorf("invalid VirtualAddrNetworkIPv6: /%d is too small, need /104 or larger", bits)
+		}
+	}
+	switch c.LogLevel {
+	case "", "debug", "info", "notice", "warn", "err":
+	default:
+		return fmt.Errorf("invalid LogLevel: %q", c.LogLevel)
+	}
+	if c.OwningControllerProcess < 0 {
+		return fmt.Errorf("invalid OwningControllerProcess: %d", c.OwningControllerProcess)
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid ShutdownTimeout: %v", c.ShutdownTimeout)
+	}
+	if c.LogFile != "" {
+		// Make sure the log folder exists and Tor will be able to write into it
+		dir := filepath.Dir(c.LogFile)
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("invalid LogFile: %v", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("invalid LogFile: %s is not a directory", dir)
+		}
+		probe, err := ioutil.TempFile(dir, ".libtor-probe-")
+		if err != nil {
+			return fmt.Errorf("invalid LogFile: directory not writable: %v", err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+	return nil
+}
+
+// shutdownTimeout returns the time Tor is given to shut down gracefully.
+func (c *Config) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == 0 {
+		return defaultShutdownTimeout
+	}
+	return c.ShutdownTimeout
+}
+
+// Args serializes the configuration into Tor command line arguments.
+func (c *Config) Args() []string {
+	var args []string
+	if c.VirtualAddrNetworkIPv4 != "" {
+		args = append(args, "--VirtualAddrNetworkIPv4", c.VirtualAddrNetworkIPv4)
+	}
+	if c.VirtualAddrNetworkIPv6 != "" {
+		args = append(args, "--VirtualAddrNetworkIPv6", c.VirtualAddrNetworkIPv6)
+	}
+	if c.AutomapHostsOnResolve {
+		args = append(args, "--AutomapHostsOnResolve", "1")
+	}
+	if c.OwningControllerProcess != 0 {
+		args = append(args, "--__OwningControllerProcess", strconv.Itoa(c.OwningControllerProcess))
+	}
+	level := c.LogLevel
+	if level == "" {
+		level = "notice"
+	}
+	if c.LogFile != "" {
+		args = append(args, "--Log", level+" file "+c.LogFile)
+	}
+	if c.LogSyslog {
+		args = append(args, "--Log", level+" syslog")
+	}
+	return append(args, c.ExtraArgs...)
+}
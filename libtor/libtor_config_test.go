@@ -0,0 +1,81 @@
+package libtor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Tests that the logging options are serialized into the right Log directives,
+// falling back to the notice level if none is set.
+func TestConfigLogArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtor-test-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tor.log")
+
+	tests := []struct {
+		name string
+		conf Config
+		want []string
+	}{
+		{"level only", Config{LogLevel: "info"}, nil},
+		{"file", Config{LogFile: path}, []string{"--Log", "notice file " + path}},
+		{"file with level", Config{LogLevel: "debug", LogFile: path}, []string{"--Log", "debug file " + path}},
+		{"syslog", Config{LogSyslog: true}, []string{"--Log", "notice syslog"}},
+		{"file and syslog", Config{LogLevel: "warn", LogFile: path, LogSyslog: true}, []string{"--Log", "warn file " + path, "--Log", "warn syslog"}},
+	}
+	for _, tt := range tests {
+		if err := tt.conf.Validate(); err != nil {
+			t.Errorf("%s: validation failed: %v", tt.name, err)
+			continue
+		}
+		if have := tt.conf.Args(); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s: args mismatch: have %q, want %q", tt.name, have, tt.want)
+		}
+	}
+}
+
+// Tests that invalid logging options are rejected before Tor is started.
+func TestConfigLogValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtor-test-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	tests := []struct {
+		name string
+		conf Config
+	}{
+		{"invalid level", Config{LogLevel: "verbose"}},
+		{"invalid level with file", Config{LogLevel: "NOTICE", LogFile: filepath.Join(dir, "tor.log")}},
+		{"missing folder", Config{LogFile: filepath.Join(dir, "missing", "tor.log")}},
+		{"folder is a file", Config{LogFile: filepath.Join(file, "tor.log")}},
+	}
+	// Permissions don't restrict root and Windows ignores them on folders
+	if os.Geteuid() > 0 && runtime.GOOS != "windows" {
+		locked := filepath.Join(dir, "locked")
+		if err := os.Mkdir(locked, 0500); err != nil {
+			t.Fatalf("failed to create read-only folder: %v", err)
+		}
+		tests = append(tests, struct {
+			name string
+			conf Config
+		}{"read-only folder", Config{LogFile: filepath.Join(locked, "tor.log")}})
+	}
+	for _, tt := range tests {
+		if err := tt.conf.Validate(); err == nil {
+			t.Errorf("%s: invalid config accepted", tt.name)
+		}
+	}
+}
@@ -0,0 +1,627 @@
+package libtor
+
+// This file contains a minimal client of Tor's control protocol, for consumers
+// that want to talk to the embedded Tor without pulling in a full controller
+// library such as bine.
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// controlReply is a complete reply of Tor to a command or an asynchronous event,
+// made up of one or more lines sharing the same status code.
+type controlReply struct {
+	code  int      // Status code of the reply (e.g. 250, 650)
+	lines []string // Text of each line, with any data block appended
+}
+
+// err converts an unsuccessful reply into an error, returning nil for 2xx ones.
+func (r *controlReply) err() error {
+	if r.code >= 200 && r.code < 300 {
+		return nil
+	}
+	return fmt.Errorf("tor error %d: %s", r.code, strings.Join(r.lines, "\n"))
+}
+
+// ControlConn is a connection speaking Tor's control protocol, taking care of the
+// framing of the replies (including the multi-line and data ones) and separating
+// asynchronous events from the replies to commands. It's safe for concurrent use.
+//
+// The commands have variants taking a context (e.g. GetInfoContext), which stop
+// waiting for the reply when it's done. The connection stays usable afterwards:
+// the late reply is discarded when it eventually arrives.
+type ControlConn struct {
+	conn net.Conn        // Raw connection to Tor's control port or socket
+	text *textproto.Conn // Line based reader and writer on top of conn
+
+	lock        sync.Mutex           // Serializes sending the commands
+	pendingLock sync.Mutex           // Protects the pending reply queue
+	pending     []chan *controlReply // Reply slots of the commands sent, in order
+	events      chan string          // Asynchronous events subscribed to via SetEvents
+	failure     error                // Error that terminated the reader, if any
+	closed      chan struct{}        // Closed when the reader terminates
+
+	circuits chan *Circuit // Parsed CIRC events, also delivered on events
+	streams  chan *Stream  // Parsed STREAM events, also delivered on events
+
+	authenticated bool // Whether the connection needs no authentication
+}
+
+// NewControlConn wraps a connection to Tor's control port (or socket) into a
+// control protocol client. The connection must be authenticated before any
+// other command is sent.
+func NewControlConn(conn net.Conn) *ControlConn {
+	c := &ControlConn{
+		conn:   conn,
+		text:   textproto.NewConn(conn),
+		events: make(chan string, 64),
+		closed: make(chan struct{}),
+
+		circuits: make(chan *Circuit, 64),
+		streams:  make(chan *Stream, 64),
+	}
+	go c.loop()
+	return c
+}
+
+// ControlConn sets up an owning control socket for the embedded Tor (see the
+// ControlSocket method) and wraps it into a control protocol client. The socket
+// is pre-authenticated, so Authenticate is a noop on it.
+func (c *TorConfig) ControlConn() (*ControlConn, error) {
+	conn, err := c.ControlSocket()
+	if err != nil {
+		return nil, err
+	}
+	ctrl := NewControlConn(conn)
+	ctrl.authenticated = true
+	return ctrl, nil
+}
+
+// loop reads the replies sent by Tor, routing the asynchronous events (6xx) to
+// the events channels and everything else to the oldest pending command. Reply
+// slots are buffered, so a command that gave up waiting never blocks the loop.
+func (c *ControlConn) loop() {
+	defer close(c.closed)
+
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			c.failure = err
+			return
+		}
+		if reply.code/100 != 6 {
+			c.pendingLock.Lock()
+			if len(c.pending) == 0 {
+				c.pendingLock.Unlock()
+				c.failure = fmt.Errorf("unsolicited control reply: %d %s", reply.code, strings.Join(reply.lines, "\n"))
+				return
+			}
+			slot := c.pending[0]
+			c.pending = c.pending[1:]
+			c.pendingLock.Unlock()
+
+			slot <- reply
+			continue
+		}
+		event := strings.Join(reply.lines, "\n")
+		for {
+			select {
+			case c.events <- event:
+			default:
+				// Nobody's reading, drop the oldest event to make room
+				select {
+				case <-c.events:
+				default:
+				}
+				continue
+			}
+			break
+		}
+		// Deliver the circuit and stream events parsed too
+		switch {
+		case strings.HasPrefix(event, "CIRC "):
+			if circuit, err := parseCircuit(event[5:]); err == nil {
+				for {
+					select {
+					case c.circuits <- circuit:
+					default:
+						select {
+						case <-c.circuits:
+						default:
+						}
+						continue
+					}
+					break
+				}
+			}
+		case strings.HasPrefix(event, "STREAM "):
+			if stream, err := parseStream(event[7:]); err == nil {
+				for {
+					select {
+					case c.streams <- stream:
+					default:
+						select {
+						case <-c.streams:
+						default:
+						}
+						continue
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// readReply reads a single, potentially multi-line reply from Tor. Lines are of
+// the form "250-text" (mid reply), "250+text" (followed by a data block ending
+// in a lone dot) or "250 text" (end of reply).
+func (c *ControlConn) readReply() (*controlReply, error) {
+	reply := new(controlReply)
+	for {
+		line, err := c.text.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 4 {
+			return nil, fmt.Errorf("malformed control reply: %q", line)
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil {
+			return nil, fmt.Errorf("malformed control reply: %q", line)
+		}
+		if reply.code != 0 && reply.code != code {
+			return nil, fmt.Errorf("control reply code changed from %d to %d", reply.code, code)
+		}
+		reply.code = code
+
+		text := line[4:]
+		switch line[3] {
+		case ' ':
+			reply.lines = append(reply.lines, text)
+			return reply, nil
+
+		case '-':
+			reply.lines = append(reply.lines, text)
+
+		case '+':
+			data, err := c.text.ReadDotLines()
+			if err != nil {
+				return nil, err
+			}
+			reply.lines = append(reply.lines, text+strings.Join(data, "\n"))
+
+		default:
+			return nil, fmt.Errorf("malformed control reply: %q", line)
+		}
+	}
+}
+
+// request sends a command to Tor and waits for its reply, failing if the reply
+// is not successful or the context is done first. If the command can't be sent
+// in full, the connection is closed, as the protocol stream is corrupt.
+func (c *ControlConn) request(ctx context.Context, format string, args ...interface{}) (*controlReply, error) {
+	slot := make(chan *controlReply, 1)
+
+	c.lock.Lock()
+	c.pendingLock.Lock()
+	c.pending = append(c.pending, slot)
+	c.pendingLock.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+	}
+	err := c.text.PrintfLine(format, args...)
+	c.conn.SetWriteDeadline(time.Time{})
+	c.lock.Unlock()
+
+	if err != nil {
+		c.conn.Close()
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			return nil, context.DeadlineExceeded
+		}
+		return nil, err
+	}
+	select {
+	case reply := <-slot:
+		return reply, reply.err()
+	case <-c.closed:
+		if c.failure != nil {
+			return nil, c.failure
+		}
+		return nil, errors.New("control connection closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Authenticate authenticates the connection, using whichever of the methods
+// advertised by Tor needs no secrets from the caller: none at all, or the auth
+// cookie file (via the SAFECOOKIE handshake if possible, so the cookie is never
+// revealed to a spoofed control port). Use AuthenticatePassword for password
+// protected control ports.
+func (c *ControlConn) Authenticate() error {
+	if c.authenticated {
+		return nil
+	}
+	reply, err := c.request(context.Background(), "PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var (
+		methods []string
+		cookie  string
+	)
+	for _, line := range reply.lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		for _, field := range strings.Fields(line[5:]) {
+			switch {
+			case strings.HasPrefix(field, "METHODS="):
+				methods = strings.Split(field[8:], ",")
+			case strings.HasPrefix(field, "COOKIEFILE="):
+				if cookie, err = strconv.Unquote(field[11:]); err != nil {
+					return fmt.Errorf("malformed cookie file path: %v", err)
+				}
+			}
+		}
+	}
+	for _, method := range methods {
+		if method == "NULL" {
+			_, err = c.request(context.Background(), "AUTHENTICATE")
+			c.authenticated = err == nil
+			return err
+		}
+	}
+	for _, method := range methods {
+		if method == "SAFECOOKIE" && cookie != "" {
+			err = c.authenticateSafeCookie(cookie)
+			c.authenticated = err == nil
+			return err
+		}
+	}
+	for _, method := range methods {
+		if method == "COOKIE" && cookie != "" {
+			blob, err := ioutil.ReadFile(cookie)
+			if err != nil {
+				return fmt.Errorf("failed to read auth cookie: %v", err)
+			}
+			_, err = c.request(context.Background(), "AUTHENTICATE %s", hex.EncodeToString(blob))
+			c.authenticated = err == nil
+			return err
+		}
+	}
+	return fmt.Errorf("unsupported authentication methods: %s", strings.Join(methods, ","))
+}
+
+// Keys of the HMACs proving the knowledge of the auth cookie in SAFECOOKIE.
+const (
+	safeCookieServerKey = "Tor safe cookie authentication server-to-controller hash"
+	safeCookieClientKey = "Tor safe cookie authentication controller-to-server hash"
+)
+
+// authenticateSafeCookie runs the SAFECOOKIE handshake (AUTHCHALLENGE), where
+// both sides prove they know the auth cookie, bound to a pair of fresh nonces.
+func (c *ControlConn) authenticateSafeCookie(path string) error {
+	cookie, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read auth cookie: %v", err)
+	}
+	clientNonce := make([]byte, 32)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	reply, err := c.request(context.Background(), "AUTHCHALLENGE SAFECOOKIE %s", hex.EncodeToString(clientNonce))
+	if err != nil {
+		return err
+	}
+	// Parse the "AUTHCHALLENGE SERVERHASH=<hex> SERVERNONCE=<hex>" reply
+	var serverHash, serverNonce []byte
+	for _, field := range strings.Fields(reply.lines[0]) {
+		switch {
+		case strings.HasPrefix(field, "SERVERHASH="):
+			serverHash, err = hex.DecodeString(field[11:])
+		case strings.HasPrefix(field, "SERVERNONCE="):
+			serverNonce, err = hex.DecodeString(field[12:])
+		}
+		if err != nil {
+			return fmt.Errorf("malformed AUTHCHALLENGE reply: %q", reply.lines[0])
+		}
+	}
+	if serverHash == nil || serverNonce == nil {
+		return fmt.Errorf("malformed AUTHCHALLENGE reply: %q", reply.lines[0])
+	}
+	// Make sure Tor knows the cookie too before revealing anything derived from it
+	msg := bytes.Join([][]byte{cookie, clientNonce, serverNonce}, nil)
+	if !hmac.Equal(serverHash, safeCookieHash(safeCookieServerKey, msg)) {
+		return errors.New("tor failed to prove knowledge of the auth cookie")
+	}
+	_, err = c.request(context.Background(), "AUTHENTICATE %s", hex.EncodeToString(safeCookieHash(safeCookieClientKey, msg)))
+	return err
+}
+
+// safeCookieHash computes one of the HMAC-SHA256 proofs of SAFECOOKIE.
+func safeCookieHash(key string, msg []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// AuthenticatePassword authenticates the connection with the password whose hash
+// was set as HashedControlPassword (see HashControlPassword).
+func (c *ControlConn) AuthenticatePassword(password string) error {
+	if c.authenticated {
+		return nil
+	}
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(password)
+	if strings.ContainsAny(quoted, "\r\n") {
+		return errors.New("control password with line breaks")
+	}
+	_, err := c.request(context.Background(), "AUTHENTICATE \"%s\"", quoted)
+	c.authenticated = err == nil
+	return err
+}
+
+// HashControlPassword hashes a control port password the same way as
+// tor --hash-password, for Tor's HashedControlPassword option. The result is in
+// Tor's "16:<hex>" format: a random salt and the iterated and salted S2K
+// (OpenPGP, RFC 2440) SHA-1 digest of the password.
+func HashControlPassword(password string) (string, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	return "16:" + strings.ToUpper(hex.EncodeToString(hashS2K(password, salt, s2kIterations))), nil
+}
+
+// s2kIterations is the encoded S2K iteration count used by Tor, standing for
+// 65536 bytes of salt and password being hashed.
+const s2kIterations = 0x60
+
+// hashS2K computes the iterated and salted S2K specifier of a secret: the salt,
+// the encoded iteration count and the SHA-1 digest of the salt and secret being
+// repeated until the count is reached.
+func hashS2K(secret string, salt []byte, iterations byte) []byte {
+	count := (16 + int(iterations&15)) << ((iterations >> 4) + 6)
+	block := append(append([]byte{}, salt...), secret...)
+
+	hash := sha1.New()
+	for count > 0 {
+		n := len(block)
+		if n > count {
+			n = count
+		}
+		hash.Write(block[:n])
+		count -= n
+	}
+	return hash.Sum(append(append([]byte{}, salt...), iterations))
+}
+
+// GetInfo retrieves the values of the requested keys (GETINFO).
+func (c *ControlConn) GetInfo(keys ...string) (map[string]string, error) {
+	return c.GetInfoContext(context.Background(), keys...)
+}
+
+// GetInfoContext is GetInfo, giving up on the reply when the context is done.
+func (c *ControlConn) GetInfoContext(ctx context.Context, keys ...string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return map[string]string{}, nil
+	}
+	reply, err := c.request(ctx, "GETINFO %s", strings.Join(keys, " "))
+	if err != nil {
+		return nil, err
+	}
+	// Every line but the closing OK is a key=value pair
+	values := make(map[string]string)
+	for _, line := range reply.lines[:len(reply.lines)-1] {
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("malformed GETINFO reply: %q", line)
+		}
+		values[line[:eq]] = line[eq+1:]
+	}
+	return values, nil
+}
+
+// ConfError is returned when Tor rejects a configuration change or lookup, with
+// 552 for an unrecognized option or value and 513 for an unacceptable one.
+type ConfError struct {
+	Code    int    // Status code of Tor's reply
+	Message string // Human readable reason reported by Tor
+}
+
+// Error implements error, formatting the reply of Tor.
+func (e *ConfError) Error() string {
+	return fmt.Sprintf("configuration rejected: %d %s", e.Code, e.Message)
+}
+
+// confRequest sends a configuration command to Tor, converting its rejections
+// into ConfErrors.
+func (c *ControlConn) confRequest(ctx context.Context, cmd string) (*controlReply, error) {
+	reply, err := c.request(ctx, "%s", cmd)
+	if err != nil && reply != nil && (reply.code == 552 || reply.code == 513) {
+		return nil, &ConfError{Code: reply.code, Message: strings.Join(reply.lines, "\n")}
+	}
+	return reply, err
+}
+
+// GetConf retrieves the current values of the requested options (GETCONF), keyed
+// by their canonical names. Options taking several lines (e.g. Bridge) have all
+// of them listed, unset ones none.
+func (c *ControlConn) GetConf(keys ...string) (map[string][]string, error) {
+	return c.GetConfContext(context.Background(), keys...)
+}
+
+// GetConfContext is GetConf, giving up on the reply when the context is done.
+func (c *ControlConn) GetConfContext(ctx context.Context, keys ...string) (map[string][]string, error) {
+	values := make(map[string][]string)
+	if len(keys) == 0 {
+		return values, nil
+	}
+	for _, key := range keys {
+		if !validConfKey(key) {
+			return nil, fmt.Errorf("invalid option name: %q", key)
+		}
+	}
+	reply, err := c.confRequest(ctx, "GETCONF "+strings.Join(keys, " "))
+	if err != nil {
+		return nil, err
+	}
+	// Every line is either a key=value pair or a lone key for unset options
+	for _, line := range reply.lines {
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			if _, ok := values[line]; !ok {
+				values[line] = nil
+			}
+			continue
+		}
+		values[line[:eq]] = append(values[line[:eq]], unquoteControl(line[eq+1:]))
+	}
+	return values, nil
+}
+
+// SetConf changes the values of options at runtime (SETCONF), without restarting
+// Tor. Every value of an option replaces all of its previous lines, so repeatable
+// options (e.g. Bridge) take several; options without values are reset to their
+// defaults. The changes are applied atomically: if Tor rejects any of them with a
+// ConfError, none take effect.
+func (c *ControlConn) SetConf(options map[string][]string) error {
+	return c.SetConfContext(context.Background(), options)
+}
+
+// SetConfContext is SetConf, giving up on the reply when the context is done. The
+// changes may still be applied by Tor after giving up.
+func (c *ControlConn) SetConfContext(ctx context.Context, options map[string][]string) error {
+	cmd, err := confCommand("SETCONF", options)
+	if err != nil || cmd == "" {
+		return err
+	}
+	_, err = c.confRequest(ctx, cmd)
+	return err
+}
+
+// ResetConf resets options to their defaults (RESETCONF), dropping all of their
+// lines.
+func (c *ControlConn) ResetConf(keys ...string) error {
+	return c.ResetConfContext(context.Background(), keys...)
+}
+
+// ResetConfContext is ResetConf, giving up on the reply when the context is done.
+func (c *ControlConn) ResetConfContext(ctx context.Context, keys ...string) error {
+	options := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		options[key] = nil
+	}
+	cmd, err := confCommand("RESETCONF", options)
+	if err != nil || cmd == "" {
+		return err
+	}
+	_, err = c.confRequest(ctx, cmd)
+	return err
+}
+
+// confCommand assembles a SETCONF or RESETCONF command out of the options, in the
+// order of their names and with every value quoted. An empty command is returned
+// if there are no options.
+func confCommand(verb string, options map[string][]string) (string, error) {
+	if len(options) == 0 {
+		return "", nil
+	}
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		if !validConfKey(key) {
+			return "", fmt.Errorf("invalid option name: %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cmd := verb
+	for _, key := range keys {
+		if len(options[key]) == 0 {
+			cmd += " " + key
+			continue
+		}
+		for _, value := range options[key] {
+			if strings.ContainsAny(value, "\r\n") {
+				return "", fmt.Errorf("invalid %s value with line breaks: %q", key, value)
+			}
+			cmd += " " + key + "=" + quoteControl(value)
+		}
+	}
+	return cmd, nil
+}
+
+// validConfKey reports whether an option name is safe to send to Tor as is.
+func validConfKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, ch := range key {
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteControl quotes a value for the control protocol, escaping the backslashes
+// and quotes in it.
+func quoteControl(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// Signal sends a signal to Tor (SIGNAL), such as NEWNYM, RELOAD or SHUTDOWN.
+func (c *ControlConn) Signal(name string) error {
+	return c.SignalContext(context.Background(), name)
+}
+
+// SignalContext is Signal, giving up on the reply when the context is done. The
+// signal may still be acted upon by Tor after giving up.
+func (c *ControlConn) SignalContext(ctx context.Context, name string) error {
+	_, err := c.request(ctx, "SIGNAL %s", name)
+	return err
+}
+
+// SetEvents subscribes to the given asynchronous events (SETEVENTS), replacing
+// any previous subscriptions. The events are delivered on the Events channel.
+func (c *ControlConn) SetEvents(events ...string) error {
+	if len(events) == 0 {
+		_, err := c.request(context.Background(), "SETEVENTS")
+		return err
+	}
+	_, err := c.request(context.Background(), "SETEVENTS %s", strings.Join(events, " "))
+	return err
+}
+
+// Events returns the channel the subscribed asynchronous events are delivered on,
+// each being the raw text of the event (e.g. "CIRC 1 LAUNCHED ..."), with the
+// lines of multi-line events joined by newlines. Events are dropped, keeping the
+// latest ones, if the channel is not drained fast enough.
+func (c *ControlConn) Events() <-chan string {
+	return c.events
+}
+
+// Close tears down the control connection. On an owning control socket, this
+// makes Tor exit.
+func (c *ControlConn) Close() error {
+	return c.conn.Close()
+}
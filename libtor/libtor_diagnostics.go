@@ -0,0 +1,120 @@
+package libtor
+
+// This file contains the bootstrap diagnostics of the embedded Tor, collecting
+// what the controller knows about a stuck or failed bootstrap into one report.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cretz/bine/control"
+)
+
+// statusHistory is the number of recent client status events kept around for
+// the bootstrap diagnostics.
+const statusHistory = 32
+
+// ClientStatus is a client status event (STATUS_CLIENT) reported by Tor, such as
+// a bootstrap progress report or a warning about a dangerous or failed connection.
+type ClientStatus struct {
+	Time      time.Time         // When the event was received from Tor
+	Severity  string            // Severity of the event: NOTICE, WARN or ERR
+	Action    string            // Kind of event (e.g. BOOTSTRAP, DANGEROUS_PORT)
+	Arguments map[string]string // Keyword arguments of the event, unquoted
+}
+
+// BootstrapDiagnostics is a snapshot of what Tor reports about its connection to
+// the network, to make sense of a bootstrap that failed or doesn't progress.
+type BootstrapDiagnostics struct {
+	Phase    BootstrapStatus // Bootstrap phase Tor is in (status/bootstrap-phase)
+	Severity string          // Severity of the bootstrap phase, WARN if problems arose
+	Liveness string          // Whether Tor considers the network up or down (network-liveness)
+	Events   []ClientStatus  // Most recent client status events, oldest first
+}
+
+// String renders the diagnostics as a few human readable lines, meant for logs
+// and bug reports.
+func (d *BootstrapDiagnostics) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "bootstrap: %d%% (%s: %s)", d.Phase.Percent, d.Phase.Tag, d.Phase.Summary)
+	if d.Phase.Warning != "" {
+		fmt.Fprintf(&b, ", %s: %s", strings.ToLower(d.Severity), d.Phase.Warning)
+	}
+	fmt.Fprintf(&b, "\nnetwork: %s", d.Liveness)
+	for _, event := range d.Events {
+		fmt.Fprintf(&b, "\n%s %s %s", event.Time.Format(time.RFC3339), event.Severity, event.Action)
+
+		keys := make([]string, 0, len(event.Arguments))
+		for key := range event.Arguments {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, " %s=%q", key, event.Arguments[key])
+		}
+	}
+	return b.String()
+}
+
+// Diagnose collects the current bootstrap phase, network liveness and the most
+// recent client status events of Tor. It's most useful once bootstrapping got
+// stuck or failed, but may be called at any time while Tor is running. Start
+// attaches the same report to the BootstrapError it returns.
+func (t *Tor) Diagnose() (*BootstrapDiagnostics, error) {
+	info, err := t.control.GetInfo("status/bootstrap-phase", "network-liveness")
+	if err != nil {
+		return nil, err
+	}
+	diag := new(BootstrapDiagnostics)
+	for _, kv := range info {
+		switch kv.Key {
+		case "status/bootstrap-phase":
+			status := control.ParseStatusEvent(control.EventCodeStatusClient, kv.Val)
+			diag.Phase, diag.Severity = parseBootstrap(status), status.Severity
+		case "network-liveness":
+			diag.Liveness = kv.Val
+		}
+	}
+	t.statusLock.Lock()
+	diag.Events = append([]ClientStatus(nil), t.statuses...)
+	t.statusLock.Unlock()
+
+	return diag, nil
+}
+
+// recordStatus keeps the most recent client status events of Tor around for the
+// diagnostics, until the event dispatcher terminates.
+func (t *Tor) recordStatus() error {
+	events, _, err := t.subscribe(control.EventCodeStatusClient)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				status, ok := event.(*control.StatusEvent)
+				if !ok {
+					continue
+				}
+				t.statusLock.Lock()
+				if len(t.statuses) == statusHistory {
+					t.statuses = append(t.statuses[:0], t.statuses[1:]...)
+				}
+				t.statuses = append(t.statuses, ClientStatus{
+					Time:      time.Now(),
+					Severity:  status.Severity,
+					Action:    status.Action,
+					Arguments: status.Arguments,
+				})
+				t.statusLock.Unlock()
+
+			case <-t.handled:
+				return
+			}
+		}
+	}()
+	return nil
+}
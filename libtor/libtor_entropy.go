@@ -0,0 +1,71 @@
+package libtor
+
+// This file exposes a way to contribute extra randomness into the embedded
+// OpenSSL, which is the random number generator used by Tor too, and to check
+// that it's securely seeded.
+
+/*
+#include <openssl/err.h>
+#include <openssl/rand.h>
+*/
+import "C"
+import "unsafe"
+
+// RNGError is returned when the random number generator Tor draws its keys from
+// could not be seeded securely from the operating system.
+type RNGError struct {
+	Reason string // Failure reported by OpenSSL, if any
+}
+
+// Error implements error.
+func (e *RNGError) Error() string {
+	if e.Reason == "" {
+		return "insecure random number generator: not seeded"
+	}
+	return "insecure random number generator: " + e.Reason
+}
+
+// AddEntropy mixes the given seed into OpenSSL's random number generator, which
+// Tor uses for all its key material. It is meant for environments where the OS
+// RNG may be starved at startup (e.g. early boot on embedded devices), letting
+// the application feed in extra randomness from its own sources (sensors, radio
+// noise, etc).
+//
+// The seed only ever supplements the OS RNG, it never replaces it: the data is
+// mixed into the generator state but no entropy is credited for it, so OpenSSL
+// still insists on being seeded from the operating system. Feeding predictable
+// data is thus harmless, but also useless.
+//
+// It is safe to call AddEntropy concurrently with a running Tor instance, the
+// OpenSSL generator does its own locking.
+func AddEntropy(seed []byte) {
+	if len(seed) == 0 {
+		return
+	}
+	C.RAND_add(unsafe.Pointer(&seed[0]), C.int(len(seed)), 0)
+}
+
+// CheckRNG verifies that OpenSSL's random number generator, which Tor uses for
+// all its key material (the ed25519 code included, built with a custom random
+// hook routed into Tor's), is securely seeded from the operating system. If it
+// can't be, an *RNGError is returned. At early boot, it may block until the OS
+// gathered enough entropy.
+func CheckRNG() error {
+	if C.RAND_status() == 1 {
+		return nil
+	}
+	err := new(RNGError)
+	if code := C.ERR_get_error(); code != 0 {
+		buf := make([]byte, 256)
+		C.ERR_error_string_n(code, (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf)))
+		err.Reason = C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
+	}
+	return err
+}
+
+// seedRNG mixes the entropy supplied by the configuration into the random number
+// generator and checks that it's securely seeded before Tor starts.
+func seedRNG(conf *Config) error {
+	AddEntropy(conf.Entropy)
+	return CheckRNG()
+}
@@ -0,0 +1,85 @@
+package libtor
+
+// This file exposes the GeoIP databases of Tor, which are embedded into the
+// library as the wrapped source tree doesn't ship any data files.
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoGeoIP is returned when the GeoIP databases were not embedded into the
+// library, which happens if it was wrapped before they were supported.
+var ErrNoGeoIP = errors.New("geoip databases not embedded")
+
+// geoipDB and geoip6DB are the IPv4 and IPv6 GeoIP databases of the wrapped Tor,
+// set by the generated embedding file of the target, if any.
+var geoipDB, geoip6DB []byte
+
+// WriteGeoIPFiles writes the embedded IPv4 and IPv6 GeoIP databases into dir,
+// returning their paths to pass to Tor via GeoIPFile and GeoIPv6File. Tor needs
+// them for country based node selection (e.g. ExitNodes {us}) and for its geoip
+// statistics. Files already holding the same content are not rewritten.
+func WriteGeoIPFiles(dir string) (geoip, geoip6 string, err error) {
+	if geoipDB == nil || geoip6DB == nil {
+		return "", "", ErrNoGeoIP
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	geoip, geoip6 = filepath.Join(dir, "geoip"), filepath.Join(dir, "geoip6")
+
+	if err := writeGeoIPFile(geoip, geoipDB); err != nil {
+		return "", "", err
+	}
+	if err := writeGeoIPFile(geoip6, geoip6DB); err != nil {
+		return "", "", err
+	}
+	return geoip, geoip6, nil
+}
+
+// writeGeoIPFile writes a GeoIP database to path, unless it's already there.
+func writeGeoIPFile(path string, db []byte) error {
+	if blob, err := ioutil.ReadFile(path); err == nil && bytes.Equal(blob, db) {
+		return nil
+	}
+	return ioutil.WriteFile(path, db, 0600)
+}
+
+// hasGeoIPArgs reports whether a command line already configures any of the
+// GeoIP databases, in which case the embedded ones shouldn't override them.
+func hasGeoIPArgs(args []string) bool {
+	for _, arg := range args {
+		if isGeoIPOption(strings.TrimLeft(arg, "-+/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGeoIPOptions reports whether a torrc or its additional options configure any
+// of the GeoIP databases. Tor matches option names case-insensitively, and takes
+// the "+" and "/" prefixes of the torrc lines, so the check does too.
+func hasGeoIPOptions(torrc string, options map[string][]string) bool {
+	for key := range options {
+		if isGeoIPOption(key) {
+			return true
+		}
+	}
+	for _, line := range strings.Split(torrc, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && isGeoIPOption(strings.TrimLeft(fields[0], "+/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGeoIPOption reports whether an option name is one of the GeoIP databases.
+func isGeoIPOption(name string) bool {
+	return strings.EqualFold(name, "GeoIPFile") || strings.EqualFold(name, "GeoIPv6File")
+}
@@ -0,0 +1,118 @@
+package libtor
+
+// This file contains the parsing of the periodic heartbeat messages Tor logs,
+// delivering their aggregate statistics over the controller.
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cretz/bine/control"
+)
+
+// Heartbeat is the summary Tor logs every HeartbeatPeriod, six hours by default.
+type Heartbeat struct {
+	Uptime   time.Duration // Time Tor has been running, to the minute
+	Circuits int           // Number of circuits open
+	Sent     uint64        // Bytes sent since startup, rounded as logged (kB, MB or GB)
+	Received uint64        // Bytes received since startup, rounded as logged
+	Message  string        // Message as logged by Tor, with any further statistics
+}
+
+// heartbeatRegexp matches the main heartbeat message of Tor, e.g. "Heartbeat: Tor's
+// uptime is 1 day 0:30 hours, with 12 circuits open. I've sent 5.12 MB and received
+// 48.83 MB."
+var heartbeatRegexp = regexp.MustCompile(`^Heartbeat: Tor's uptime is (?:(\d+) days? )?(\d+):(\d+) hours, with (\d+) circuits open\. I've sent ([\d.]+ [kMG]B) and received ([\d.]+ [kMG]B)\.`)
+
+// Heartbeats returns a channel delivering the heartbeats of Tor as they're logged,
+// parsed from its notice log events. The channel is closed when Tor exits. Like
+// the bootstrap progress reports, heartbeats are dropped, keeping the latest
+// ones, if the channel is not drained fast enough.
+func (t *Tor) Heartbeats() <-chan *Heartbeat {
+	heartbeats := make(chan *Heartbeat, 16)
+
+	events, unsubscribe, err := t.subscribe(control.EventCodeLogNotice)
+	if err != nil {
+		close(heartbeats)
+		return heartbeats
+	}
+	go func() {
+		defer close(heartbeats)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-t.exited:
+				return
+
+			case event := <-events:
+				log, ok := event.(*control.LogEvent)
+				if !ok {
+					continue
+				}
+				heartbeat, ok := parseHeartbeat(log.Raw)
+				if !ok {
+					continue
+				}
+				for {
+					select {
+					case heartbeats <- heartbeat:
+					default:
+						// Nobody's reading, drop the oldest heartbeat to make room
+						select {
+						case <-heartbeats:
+						default:
+						}
+						continue
+					}
+					break
+				}
+			}
+		}
+	}()
+	return heartbeats
+}
+
+// parseHeartbeat parses the main heartbeat message of Tor, reporting whether the
+// log message was one.
+func parseHeartbeat(msg string) (*Heartbeat, bool) {
+	msg = strings.TrimSpace(msg)
+
+	match := heartbeatRegexp.FindStringSubmatch(msg)
+	if match == nil {
+		return nil, false
+	}
+	days, _ := strconv.Atoi(match[1])
+	hours, _ := strconv.Atoi(match[2])
+	minutes, _ := strconv.Atoi(match[3])
+	circuits, _ := strconv.Atoi(match[4])
+
+	return &Heartbeat{
+		Uptime:   time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute,
+		Circuits: circuits,
+		Sent:     parseUsage(match[5]),
+		Received: parseUsage(match[6]),
+		Message:  msg,
+	}, true
+}
+
+// parseUsage converts a byte count formatted by Tor (e.g. "5.12 MB") back into
+// bytes, using the binary units Tor formats them with.
+func parseUsage(usage string) uint64 {
+	fields := strings.Fields(usage)
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	switch fields[1] {
+	case "kB":
+		value *= 1 << 10
+	case "MB":
+		value *= 1 << 20
+	case "GB":
+		value *= 1 << 30
+	}
+	return uint64(value)
+}
@@ -0,0 +1,86 @@
+package libtor
+
+// This file contains a running embedded Tor instance, started through the bine
+// interface and controlled via the owning control socket.
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cretz/bine/control"
+	"github.com/cretz/bine/tor"
+)
+
+// Instance is a running embedded Tor, along with an authenticated controller
+// connection to it. It should be created with NewInstance and always be closed
+// when not needed any more.
+type Instance struct {
+	tor *tor.Tor // Bine wrapper around the embedded process and controller
+}
+
+// NewInstance validates the configuration and starts a new embedded Tor with it,
+// returning once the controller connection is authenticated. If ctx is nil, the
+// background context is used; if conf is nil, Tor's defaults are used.
+func NewInstance(ctx context.Context, conf *Config) (*Instance, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if conf == nil {
+		conf = new(Config)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if err := seedRNG(conf); err != nil {
+		return nil, err
+	}
+	t, err := tor.Start(ctx, &tor.StartConf{
+		ProcessCreator:         Creator,
+		UseEmbeddedControlConn: true,
+		TempDataDirBase:        os.TempDir(),
+		EnableNetwork:          true,
+		ExtraArgs:              conf.Args(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{tor: t}, nil
+}
+
+// Control returns the authenticated controller connection of the instance.
+func (i *Instance) Control() *control.Conn {
+	return i.tor.Control
+}
+
+// Close shuts down the embedded Tor instance and tears down the controller.
+func (i *Instance) Close() error {
+	return i.tor.Close()
+}
+
+// MapAddress requests Tor to map the from address to the to address (MAPADDRESS
+// control command), returning the address actually mapped.
+//
+// The from address may be a null address to ask Tor to allocate a fresh virtual
+// address from the configured VirtualAddrNetwork: "0.0.0.0" for IPv4, "::0" for
+// IPv6 or "." for a hostname. This is how .onion addresses are made reachable
+// to applications that only speak IP.
+func (i *Instance) MapAddress(from, to string) (string, error) {
+	if from == "" || to == "" || strings.ContainsAny(from+to, " =\r\n") {
+		return "", fmt.Errorf("invalid address mapping %q -> %q", from, to)
+	}
+	mapped, err := i.tor.Control.MapAddresses(&control.KeyVal{Key: from, Val: to})
+	if err != nil {
+		return "", fmt.Errorf("failed to map address: %v", err)
+	}
+	// Tor replies with a single "250 <from>=<to>" line per requested mapping,
+	// where the from side is the actual address allocated for null requests.
+	if len(mapped) != 1 {
+		return "", fmt.Errorf("unexpected number of address mappings: %d", len(mapped))
+	}
+	if mapped[0].Key == "" || !strings.EqualFold(mapped[0].Val, to) {
+		return "", fmt.Errorf("unexpected address mapping: %s=%s", mapped[0].Key, mapped[0].Val)
+	}
+	return mapped[0].Key, nil
+}
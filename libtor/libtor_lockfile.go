@@ -0,0 +1,89 @@
+package libtor
+
+// This file contains the inspection of the lock Tor takes on its data folder,
+// telling a folder in use by a live Tor apart from one a crashed instance left
+// behind.
+
+/*
+#include <errno.h>
+#include <fcntl.h>
+#include <stdlib.h>
+#ifdef _WIN32
+#include <io.h>
+#include <sys/locking.h>
+#else
+#include <sys/file.h>
+#include <unistd.h>
+#endif
+
+// probeLock takes and releases the lock on the given file the same way Tor does
+// (see tor_lockfile_lock), returning 1 if someone else holds it, 0 if it's free
+// and -1 (with errno set) if it can't be taken at all.
+static int probeLock(const char *path) {
+	int fd, res = 0;
+
+	if ((fd = open(path, O_RDWR | O_CREAT, 0600)) < 0) {
+		return -1;
+	}
+#ifdef _WIN32
+	_lseek(fd, 0, SEEK_SET);
+	if (_locking(fd, _LK_NBLCK, 1) < 0) {
+		res = (errno == EACCES || errno == EDEADLOCK) ? 1 : -1;
+	} else {
+		_lseek(fd, 0, SEEK_SET);
+		_locking(fd, _LK_UNLCK, 1);
+	}
+#else
+	if (flock(fd, LOCK_EX | LOCK_NB) < 0) {
+		res = (errno == EWOULDBLOCK) ? 1 : -1;
+	} else {
+		flock(fd, LOCK_UN);
+	}
+#endif
+	int saved = errno;
+	close(fd);
+	errno = saved;
+	return res;
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// ErrDataDirLocked is returned by Start if the data folder is in use by another
+// Tor, be it another process or one started via RunTor in this process. Tor
+// would wait a few seconds for it to go away and exit with a startup error.
+var ErrDataDirLocked = errors.New("data folder locked by another tor process")
+
+// checkDataDirLock verifies that Tor will be able to lock its data folder. The
+// lock is advisory and dropped by the kernel when its holder dies, so a held one
+// always belongs to a live process and is never taken over. A crashed instance
+// may however leave a lock file behind that Tor can't open (e.g. owned by another
+// user after running as root), which is removed if steal is set.
+func checkDataDirLock(dir string, steal bool) error {
+	path := filepath.Join(dir, "lock")
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	res, err := C.probeLock(cpath)
+	switch {
+	case res == 0:
+		return nil
+	case res > 0:
+		return ErrDataDirLocked
+	case !steal:
+		return fmt.Errorf("stale data folder lock %s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale data folder lock: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package libtor
+
+// This file contains the onion service management of the embedded Tor, creating
+// ephemeral services and managing client authorization over the owning
+// controller.
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cretz/bine/control"
+)
+
+// OnionConf is the configuration of an onion service to create.
+type OnionConf struct {
+	// Key is the private key of the service, in the format Tor returns it in
+	// (e.g. "ED25519-V3:<base64>") and Onion.Key holds. Passing back the key of a
+	// previous service republishes the same .onion address. If empty, a new v3
+	// key is generated.
+	Key string
+
+	// Ports maps the virtual ports of the service to the local targets incoming
+	// connections are forwarded to, either a port, a host:port pair or a unix
+	// socket (unix:/path). An empty target forwards to the same local port.
+	Ports map[int]string
+
+	// Detach, if set, keeps the service published when the controller that
+	// created it disconnects (Flags=Detach). The service still disappears when
+	// Tor exits, which for the embedded one happens when it's closed.
+	Detach bool
+}
+
+// Onion is an onion service published by the embedded Tor. It should be closed
+// to unpublish it when not needed any more.
+type Onion struct {
+	ID  string // Service ID, the address without the .onion suffix
+	Key string // Private key of the service, to recreate it with OnionConf.Key
+
+	tor *Tor // Embedded Tor the service is published by
+
+	descs     chan *OnionDescEvent // Descriptor events of the service, see Descriptors
+	published chan struct{}        // Closed when a descriptor is first uploaded
+	closed    chan struct{}        // Closed when the service is unpublished
+	closeOnce sync.Once            // Guards closing the closed channel
+}
+
+// OnionDescEvent is a step in the lifecycle of a descriptor of an onion service,
+// as reported by Tor (HS_DESC). A v3 service builds a descriptor (CREATED) for
+// the current and the next time period each, then uploads them (UPLOAD) to a
+// handful of HSDirs per replica, each of which accepting (UPLOADED) or rejecting
+// (FAILED) it. Descriptors are rebuilt and uploaded again periodically.
+type OnionDescEvent struct {
+	Action   string // CREATED, UPLOAD, UPLOADED or FAILED
+	HSDir    string // Fingerprint of the HSDir uploaded to, empty for CREATED
+	Nickname string // Nickname of the HSDir, empty if unknown
+	DescID   string // Blinded key of the descriptor, if reported
+	Reason   string // Reason a FAILED upload was rejected (e.g. UPLOAD_REJECTED)
+}
+
+// CreateOnion publishes an onion service (ADD_ONION) forwarding connections to
+// the configured local targets. It returns as soon as Tor accepted the service,
+// the descriptors being uploaded in the background.
+func (t *Tor) CreateOnion(conf *OnionConf) (*Onion, error) {
+	if conf == nil || len(conf.Ports) == 0 {
+		return nil, errors.New("onion service without ports")
+	}
+	req := new(control.AddOnionRequest)
+
+	// Reuse the supplied key if any, otherwise let Tor generate a fresh v3 one
+	if conf.Key != "" {
+		key, err := control.KeyFromString(conf.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid onion key: %v", err)
+		}
+		req.Key = key
+	} else {
+		req.Key = control.GenKey(control.KeyAlgoED25519V3)
+	}
+	// Assemble the port mappings in a stable order
+	virts := make([]int, 0, len(conf.Ports))
+	for virt := range conf.Ports {
+		if virt <= 0 || virt > 65535 {
+			return nil, fmt.Errorf("invalid onion virtual port: %d", virt)
+		}
+		virts = append(virts, virt)
+	}
+	sort.Ints(virts)
+
+	for _, virt := range virts {
+		target := conf.Ports[virt]
+		if target != "" && !strings.HasPrefix(target, "unix:") {
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				if port, err := strconv.Atoi(target); err != nil || port <= 0 || port > 65535 {
+					return nil, fmt.Errorf("invalid onion target for port %d: %q", virt, target)
+				}
+			}
+		}
+		req.Ports = append(req.Ports, &control.KeyVal{Key: strconv.Itoa(virt), Val: target})
+	}
+	if conf.Detach {
+		req.Flags = append(req.Flags, "Detach")
+	}
+	// Follow the descriptor events before creating the service, not to miss any
+	events, unsubscribe, err := t.subscribe(control.EventCodeHSDesc)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.control.AddOnion(req)
+	if err != nil {
+		unsubscribe()
+		return nil, fmt.Errorf("failed to create onion service: %v", err)
+	}
+	onion := &Onion{
+		ID:        res.ServiceID,
+		Key:       conf.Key,
+		tor:       t,
+		descs:     make(chan *OnionDescEvent, 16),
+		published: make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	go onion.followDescs(events, unsubscribe)
+
+	// Tor only returns the private key if it generated it
+	if res.Key != nil {
+		onion.Key = string(res.Key.Type()) + ":" + res.Key.Blob()
+	}
+	return onion, nil
+}
+
+// Addr returns the .onion address of the service.
+func (o *Onion) Addr() string {
+	return o.ID + ".onion"
+}
+
+// Close unpublishes the onion service (DEL_ONION).
+func (o *Onion) Close() error {
+	o.closeOnce.Do(func() { close(o.closed) })
+
+	if err := o.tor.control.DelOnion(o.ID); err != nil {
+		return fmt.Errorf("failed to remove onion service: %v", err)
+	}
+	return nil
+}
+
+// Descriptors returns a channel delivering the descriptor events of the service,
+// from the moment it was created. The channel is closed when the service is closed
+// or Tor exits. Like the bootstrap progress reports, events are dropped, keeping
+// the latest ones, if the channel is not drained fast enough.
+func (o *Onion) Descriptors() <-chan *OnionDescEvent {
+	return o.descs
+}
+
+// WaitPublished blocks until a descriptor of the service was accepted by an HSDir,
+// the earliest clients have a chance to reach it. Clients fetch the descriptor
+// from one of several HSDirs though, so connections may still fail for a while
+// until the rest of the uploads went through too.
+func (o *Onion) WaitPublished(ctx context.Context) error {
+	select {
+	case <-o.published:
+		return nil
+	default:
+	}
+	select {
+	case <-o.published:
+		return nil
+	case <-o.closed:
+		return errors.New("onion service closed")
+	case <-o.tor.exited:
+		return errors.New("embedded tor exited")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// followDescs delivers the descriptor events of the service until it's closed or
+// Tor exits, noting when a descriptor is first published.
+func (o *Onion) followDescs(events <-chan control.Event, unsubscribe func()) {
+	defer close(o.descs)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-o.closed:
+			return
+
+		case <-o.tor.exited:
+			return
+
+		case event := <-events:
+			desc, ok := event.(*control.HSDescEvent)
+			if !ok || desc.Address != o.ID {
+				continue
+			}
+			// Only the service side of the lifecycle is of interest, not fetches
+			switch desc.Action {
+			case "CREATED", "UPLOAD", "UPLOADED", "FAILED":
+			default:
+				continue
+			}
+			update := &OnionDescEvent{Action: desc.Action, DescID: desc.DescID, Reason: desc.Reason}
+			if desc.HSDir != "UNKNOWN" {
+				update.HSDir, update.Nickname = splitLongName(desc.HSDir)
+			}
+			if update.Action == "UPLOADED" {
+				select {
+				case <-o.published:
+				default:
+					close(o.published)
+				}
+			}
+			for {
+				select {
+				case o.descs <- update:
+				default:
+					// Nobody's reading, drop the oldest event to make room
+					select {
+					case <-o.descs:
+					default:
+					}
+					continue
+				}
+				break
+			}
+		}
+	}
+}
+
+// ErrOnionAuthNotFound is returned when removing the client authorization of an
+// onion service that has none registered (reply 251).
+var ErrOnionAuthNotFound = errors.New("no client authorization for onion service")
+
+// OnionAuthError is returned when Tor rejects an onion client authorization
+// command, e.g. with 512 for a malformed address or key, 551 if the key could
+// not be stored or 552 for an unrecognized flag.
+type OnionAuthError struct {
+	Code    int    // Status code of Tor's reply
+	Message string // Human readable reason reported by Tor
+}
+
+// Error implements error, formatting the reply of Tor.
+func (e *OnionAuthError) Error() string {
+	return fmt.Sprintf("onion client auth rejected: %d %s", e.Code, e.Message)
+}
+
+// OnionClientAuth is the client authorization credential of a v3 onion service,
+// needed to connect to services restricting access to authorized clients.
+type OnionClientAuth struct {
+	// Addr is the address of the onion service, with or without the .onion
+	// suffix.
+	Addr string
+
+	// Key is the x25519 private key of the client, base32 encoded as in the
+	// .auth_private files of Tor (without the "x25519:" prefix).
+	Key string
+
+	// Nickname is an optional name of the credential (ClientName).
+	Nickname string
+
+	// Permanent, if set, makes Tor store the credential into the folder set by
+	// ClientOnionAuthDir, so it survives restarts. Otherwise it's kept in memory.
+	Permanent bool
+}
+
+// AddOnionClientAuth registers a client authorization credential for an onion
+// service (ONION_CLIENT_AUTH_ADD), replacing any previous one for the same
+// service.
+func (t *Tor) AddOnionClientAuth(auth *OnionClientAuth) error {
+	if auth == nil {
+		return errors.New("missing onion client auth")
+	}
+	addr, err := onionServiceID(auth.Addr)
+	if err != nil {
+		return err
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(auth.Key))
+	if err != nil || len(key) != 32 {
+		return errors.New("invalid onion client auth key: want 52 base32 characters (32 bytes)")
+	}
+	cmd := "ONION_CLIENT_AUTH_ADD " + addr + " x25519:" + auth.Key
+	if auth.Nickname != "" {
+		if strings.ContainsAny(auth.Nickname, " \r\n\"") {
+			return fmt.Errorf("invalid onion client auth nickname: %q", auth.Nickname)
+		}
+		cmd += " ClientName=" + auth.Nickname
+	}
+	if auth.Permanent {
+		cmd += " Flags=Permanent"
+	}
+	if _, err := t.control.SendRequest(cmd); err != nil {
+		return onionAuthErr(err)
+	}
+	return nil
+}
+
+// RemoveOnionClientAuth removes the client authorization credential of an onion
+// service (ONION_CLIENT_AUTH_REMOVE), returning ErrOnionAuthNotFound if there was
+// none.
+func (t *Tor) RemoveOnionClientAuth(addr string) error {
+	id, err := onionServiceID(addr)
+	if err != nil {
+		return err
+	}
+	res, err := t.control.SendRequest("ONION_CLIENT_AUTH_REMOVE " + id)
+	if err != nil {
+		return onionAuthErr(err)
+	}
+	if res.Err.Code == control.StatusOkUnnecessary {
+		return ErrOnionAuthNotFound
+	}
+	return nil
+}
+
+// OnionClientAuths lists the client authorization credentials registered in Tor
+// (ONION_CLIENT_AUTH_VIEW).
+func (t *Tor) OnionClientAuths() ([]*OnionClientAuth, error) {
+	res, err := t.control.SendRequest("ONION_CLIENT_AUTH_VIEW")
+	if err != nil {
+		return nil, onionAuthErr(err)
+	}
+	// Each credential is reported as "CLIENT <addr> x25519:<key> [opts]"
+	var auths []*OnionClientAuth
+	for _, line := range res.Data {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "CLIENT" {
+			continue
+		}
+		auth := &OnionClientAuth{
+			Addr: fields[1],
+			Key:  strings.TrimPrefix(fields[2], "x25519:"),
+		}
+		for _, opt := range fields[3:] {
+			switch {
+			case strings.HasPrefix(opt, "ClientName="):
+				auth.Nickname = strings.TrimPrefix(opt, "ClientName=")
+			case opt == "Flags=Permanent":
+				auth.Permanent = true
+			}
+		}
+		auths = append(auths, auth)
+	}
+	return auths, nil
+}
+
+// onionServiceID validates a v3 onion address and strips any .onion suffix.
+func onionServiceID(addr string) (string, error) {
+	id := strings.TrimSuffix(strings.ToLower(addr), ".onion")
+	if len(id) != 56 {
+		return "", fmt.Errorf("invalid v3 onion address: %q", addr)
+	}
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(id)); err != nil {
+		return "", fmt.Errorf("invalid v3 onion address: %q", addr)
+	}
+	return id, nil
+}
+
+// onionAuthErr converts an error reply of Tor into an OnionAuthError, leaving any
+// other failures (e.g. connection errors) untouched.
+func onionAuthErr(err error) error {
+	if reply, ok := err.(*textproto.Error); ok {
+		return &OnionAuthError{Code: reply.Code, Message: reply.Msg}
+	}
+	return err
+}
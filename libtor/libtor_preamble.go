@@ -2,10 +2,27 @@ package libtor
 
 /*
 #cgo linux,amd64,!android linux,arm64,!android CFLAGS: -DARCH_LINUX64
+#cgo linux,riscv64,!android                    CFLAGS: -DARCH_LINUX64
 #cgo linux,386,!android linux,arm,!android     CFLAGS: -DARCH_LINUX32
-#cgo darwin,amd64,!ios darwin,arm64,!ios       CFLAGS: -DARCH_MACOS64
-#cgo ios,amd64 ios,arm64                       CFLAGS: -DARCH_IOS64
+#cgo linux,mips64le,!android                   CFLAGS: -DARCH_LINUX64_MIPS
+#cgo linux,mipsle,!android                     CFLAGS: -DARCH_LINUX32_MIPS
+#cgo linux,ppc64le,!android                    CFLAGS: -DARCH_LINUX64_PPC
+#cgo linux,s390x,!android                      CFLAGS: -DARCH_LINUX64_S390X
+#cgo darwin,amd64,!ios                         CFLAGS: -DARCH_MACOS64
+#cgo darwin,arm64,!ios                         CFLAGS: -DARCH_MACOS64_ARM64
+#cgo ios,arm64,!iossimulator                   CFLAGS: -DARCH_IOS64
+#cgo ios,amd64 ios,arm64,iossimulator          CFLAGS: -DARCH_IOS64_SIMULATOR
 #cgo android,amd64 android,arm64               CFLAGS: -DARCH_ANDROID64
-#cgo android,386 android,arm                   CFLAGS: -DARCH_ANDROID32
+#cgo android,arm                               CFLAGS: -DARCH_ANDROID32
+#cgo android,386                               CFLAGS: -DARCH_ANDROID32_X86
+#cgo windows,amd64                             CFLAGS: -DARCH_WINDOWS64
+#cgo windows,386                               CFLAGS: -DARCH_WINDOWS32
+#cgo freebsd,amd64 freebsd,arm64               CFLAGS: -DARCH_FREEBSD64
+#cgo openbsd,amd64 openbsd,arm64               CFLAGS: -DARCH_OPENBSD64
+#cgo netbsd,amd64 netbsd,arm64                 CFLAGS: -DARCH_NETBSD64
+#cgo freebsd LDFLAGS: -lpthread
+#cgo openbsd LDFLAGS: -lpthread
+#cgo netbsd LDFLAGS: -lpthread
+#cgo windows LDFLAGS: -lws2_32 -lcrypt32 -liphlpapi -lshlwapi -ladvapi32 -luser32 -lgdi32
 */
 import "C"
@@ -0,0 +1,166 @@
+package libtor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Tests that concurrent acquires let exactly one caller reserve the embedded Tor,
+// and that releasing the reservation allows it to be acquired again.
+func TestAcquireExclusive(t *testing.T) {
+	defer atomic.StoreInt32(&torState, torIdle)
+
+	var (
+		wins int32
+		pend sync.WaitGroup
+	)
+	for i := 0; i < 64; i++ {
+		pend.Add(1)
+		go func() {
+			defer pend.Done()
+			if acquire() == nil {
+				atomic.AddInt32(&wins, 1)
+			}
+		}()
+	}
+	pend.Wait()
+
+	if wins != 1 {
+		t.Fatalf("acquire winners mismatch: have %d, want 1", wins)
+	}
+	if err := acquire(); err != ErrAlreadyRunning {
+		t.Fatalf("acquire while reserved: have %v, want %v", err, ErrAlreadyRunning)
+	}
+	release()
+	if err := acquire(); err != nil {
+		t.Fatalf("acquire after release failed: %v", err)
+	}
+}
+
+// Tests that a stray release while Tor is running is ignored, and that a stopped
+// Tor is released back into the idle state.
+func TestReleaseStates(t *testing.T) {
+	defer atomic.StoreInt32(&torState, torIdle)
+
+	atomic.StoreInt32(&torState, torRunning)
+	release()
+	if state := atomic.LoadInt32(&torState); state != torRunning {
+		t.Fatalf("release while running changed state: have %d, want %d", state, torRunning)
+	}
+	if err := acquire(); err != ErrAlreadyRunning {
+		t.Fatalf("acquire while running: have %v, want %v", err, ErrAlreadyRunning)
+	}
+	atomic.StoreInt32(&torState, torStopping)
+	if err := acquire(); err != ErrAlreadyRunning {
+		t.Fatalf("acquire while stopping: have %v, want %v", err, ErrAlreadyRunning)
+	}
+	release()
+	if state := atomic.LoadInt32(&torState); state != torIdle {
+		t.Fatalf("release while stopping: have state %d, want %d", state, torIdle)
+	}
+}
+
+// startOffline starts an embedded Tor on an ephemeral data folder, with the network
+// disabled so it comes up without touching the outside world.
+func startOffline() (*Tor, error) {
+	dir, err := ioutil.TempDir("", "libtor-test-")
+	if err != nil {
+		return nil, err
+	}
+	tor, err := Start(context.Background(), &StartConf{
+		Config:        &Config{ExtraArgs: []string{"--DisableNetwork", "1"}},
+		DataDir:       dir,
+		EphemeralData: true,
+		NoWait:        true,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+	}
+	return tor, err
+}
+
+// Tests that hammering Start and Close, back-to-back, concurrently and racing
+// with a shutdown, never runs two Tors at once: every Start either succeeds or
+// fails with ErrAlreadyRunning, and every started Tor closes cleanly.
+func TestStartCloseHammer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts the embedded tor repeatedly")
+	}
+	// Back-to-back restarts must all succeed, the previous Tor being closed
+	for i := 0; i < 5; i++ {
+		tor, err := startOffline()
+		if err != nil {
+			t.Fatalf("restart %d: failed to start: %v", i, err)
+		}
+		if err := tor.Close(); err != nil {
+			t.Fatalf("restart %d: failed to close: %v", i, err)
+		}
+	}
+	// Concurrent starts must let exactly one through, rejecting the others
+	for i := 0; i < 5; i++ {
+		var (
+			pend    sync.WaitGroup
+			lock    sync.Mutex
+			started []*Tor
+		)
+		for j := 0; j < 8; j++ {
+			pend.Add(1)
+			go func() {
+				defer pend.Done()
+
+				tor, err := startOffline()
+				switch {
+				case err == nil:
+					lock.Lock()
+					started = append(started, tor)
+					lock.Unlock()
+				case err != ErrAlreadyRunning:
+					t.Errorf("round %d: failed to start: %v", i, err)
+				}
+			}()
+		}
+		pend.Wait()
+
+		if len(started) != 1 {
+			t.Errorf("round %d: started tors mismatch: have %d, want 1", i, len(started))
+		}
+		for _, tor := range started {
+			if err := tor.Close(); err != nil {
+				t.Fatalf("round %d: failed to close: %v", i, err)
+			}
+		}
+		if t.Failed() {
+			return
+		}
+	}
+	// Starts racing with a shutdown must be rejected until Tor is fully gone
+	for i := 0; i < 5; i++ {
+		tor, err := startOffline()
+		if err != nil {
+			t.Fatalf("race %d: failed to start: %v", i, err)
+		}
+		closed := make(chan error, 1)
+		go func() { closed <- tor.Close() }()
+
+		for {
+			next, err := startOffline()
+			if err == ErrAlreadyRunning {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("race %d: failed to restart: %v", i, err)
+			}
+			if err := <-closed; err != nil {
+				t.Fatalf("race %d: failed to close: %v", i, err)
+			}
+			if err := next.Close(); err != nil {
+				t.Fatalf("race %d: failed to close restarted tor: %v", i, err)
+			}
+			break
+		}
+	}
+}
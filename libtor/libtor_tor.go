@@ -0,0 +1,1284 @@
+package libtor
+
+// This file contains a high level embedded Tor, running in-process on top of the
+// embedded API and driven through its owning control socket, without any of the
+// process management of bine.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/textproto"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cretz/bine/control"
+	"golang.org/x/net/proxy"
+)
+
+// haltTimeout is the time Close waits for Tor to exit after halting it.
+const haltTimeout = 5 * time.Second
+
+// minDormantTimeout is the shortest inactivity Tor accepts before going dormant.
+const minDormantTimeout = 10 * time.Minute
+
+// minHeartbeatPeriod is the shortest interval Tor accepts between heartbeats.
+const minHeartbeatPeriod = 30 * time.Minute
+
+// defaultFallbackAfter is the time a direct bootstrap may go without progress
+// before switching to the fallback bridges.
+const defaultFallbackAfter = 30 * time.Second
+
+// dataDirRemoveAttempts and dataDirRemoveBackoff bound the retries of removing an
+// ephemeral data folder whose files are still held open.
+const (
+	dataDirRemoveAttempts = 10
+	dataDirRemoveBackoff  = 200 * time.Millisecond
+)
+
+// NewIdentityRateLimit is the minimum interval Tor enforces between two fresh
+// identities (NEWNYM). Requests within it are delayed until it passes.
+const NewIdentityRateLimit = 10 * time.Second
+
+// ErrNewIdentityRateLimited is returned by NewIdentity if the request came within
+// NewIdentityRateLimit of the previous one. Tor accepted it, but only switches to
+// the new identity once the interval passed.
+var ErrNewIdentityRateLimited = errors.New("new identity rate limited, delayed by tor")
+
+// StartConf is the configuration to start an embedded Tor with.
+type StartConf struct {
+	// Config is the typed Tor configuration. If nil, Tor's defaults are used.
+	Config *Config
+
+	// SocksPort is the localhost port Tor's SOCKS5 proxy listens on. If zero,
+	// Tor picks an unused port, discovered once it's listening.
+	SocksPort int
+
+	// SocksSocket is the path of a unix socket Tor's SOCKS5 proxy listens on
+	// instead of a TCP port, so only processes with access to it can use Tor.
+	// The folder containing it must be private to the user (created with 0700
+	// if missing). It's mutually exclusive with SocksPort.
+	SocksSocket string
+
+	// ControlSocket is the path of a unix socket Tor accepts additional control
+	// connections on, authenticated with the cookie file in the data folder
+	// (see DialControl). The same folder requirements as for SocksSocket apply.
+	// If empty, only the owning controller can control Tor.
+	ControlSocket string
+
+	// Torrc is the content of a torrc file to configure Tor with, e.g. an existing
+	// one being migrated into the application. It's written into the data folder
+	// and handed to Tor via -f, in place of any torrc already in there.
+	Torrc string
+
+	// Options are further torrc directives, appended after Torrc in the order of
+	// their names. Every value is written as a separate line, so the repeatable
+	// options (e.g. Bridge, HiddenServicePort) take several. Values are quoted as
+	// needed. As in Tor, anything set on the command line (the other fields of
+	// StartConf and Config, including ExtraArgs) replaces all the lines of the
+	// same option in the torrc, except for Bridges, which are added to them.
+	// Prefixing an option in ExtraArgs with a plus (e.g. "--+SocksPort") appends
+	// it too. The embedded GeoIP databases, passed on the command line as well,
+	// are only used if neither Torrc nor Options set GeoIPFile or GeoIPv6File.
+	Options map[string][]string
+
+	// DataDir is the folder Tor keeps its state in. If empty, a temporary one
+	// is created and removed on Close. A persistent folder lets Tor reuse the
+	// cached consensus, descriptors and guards, which speeds up bootstraps after
+	// the first one considerably.
+	DataDir string
+
+	// EphemeralData, if set, removes DataDir on Close too, leaving no trace of
+	// the session behind. It's implied for the temporary data folder.
+	EphemeralData bool
+
+	// StealDataDirLock, if set, removes a lock file in DataDir that Tor can't
+	// take, as left behind by an instance that crashed (e.g. running as another
+	// user), so restarts recover on their own. A lock held by a live Tor is never
+	// taken over: Start fails with ErrDataDirLocked either way.
+	StealDataDirLock bool
+
+	// Bridges are the bridge lines (as in torrc, without the Bridge keyword) Tor
+	// should connect to the network through, instead of the public relays. The
+	// lines may use a transport, e.g. "obfs4 192.0.2.1:443 <fingerprint> cert=...
+	// iat-mode=0", as long as it's made available to Tor.
+	Bridges []string
+
+	// FallbackBridges are bridge lines (same format as Bridges) Tor is switched to
+	// if connecting directly to the network stalls, e.g. a few shipped with the
+	// application for networks blocking the public relays. They only kick in while
+	// Start waits for the bootstrap, so they can't be combined with Bridges or
+	// NoWait. Bundled bridges go stale and, being public, tend to get blocked (or
+	// overloaded) themselves, so they are best kept fresh with app updates.
+	FallbackBridges []string
+
+	// FallbackAfter is how long the bootstrap may go without progress before the
+	// FallbackBridges are used. If zero, it defaults to 30 seconds.
+	FallbackAfter time.Duration
+
+	// UseObfs4, if set, makes the obfs4 transport available to Tor, provided
+	// in-process by Obfs4 instead of a separate obfs4proxy executable.
+	UseObfs4 bool
+
+	// Obfs4 is the obfs4 client implementation used with UseObfs4, typically a
+	// thin adapter around a pure Go obfs4 library (e.g. lyrebird).
+	Obfs4 ClientTransport
+
+	// Transports are further pluggable transports run in-process, keyed by the
+	// name the bridge lines refer to them with (e.g. "snowflake"). The ones also
+	// implementing TransportLauncher are launched with their state kept in the
+	// pt_state folder of the data directory, same as for managed transports.
+	Transports map[string]ClientTransport
+
+	// DisableIPv6, if set, makes Tor connect to relays and bridges over IPv4 only
+	// (ClientUseIPv6 0), for networks where IPv6 is broken or unwanted.
+	DisableIPv6 bool
+
+	// PreferIPv6, if set, makes Tor connect over IPv6 whenever a relay or bridge
+	// has an IPv6 address (ClientUseIPv6 and ClientPreferIPv6ORPort 1), falling
+	// back to IPv4 otherwise. It's mutually exclusive with DisableIPv6.
+	PreferIPv6 bool
+
+	// BandwidthRate caps the average traffic of Tor in bytes per second, in each
+	// direction (BandwidthRate), e.g. to stay within a metered connection. Zero
+	// leaves Tor's default (1 GB/s) in place.
+	BandwidthRate uint64
+
+	// BandwidthBurst is the largest burst of traffic Tor allows itself in bytes
+	// per second (BandwidthBurst), at least BandwidthRate. Zero leaves Tor's
+	// default (1 GB/s) in place.
+	BandwidthBurst uint64
+
+	// RelayBandwidthRate caps the traffic relayed for others in bytes per second
+	// (RelayBandwidthRate), leaving the own traffic up to BandwidthRate. It only
+	// matters if Tor is configured as a relay or bridge.
+	RelayBandwidthRate uint64
+
+	// DormantTimeout is how long Tor may go without client activity before going
+	// dormant on its own (DormantClientTimeout), stopping its network activity
+	// until a new request arrives. If zero, Tor's default of 24 hours is used,
+	// otherwise it must be at least 10 minutes. See Tor.Dormant to do so at once.
+	DormantTimeout time.Duration
+
+	// HeartbeatPeriod is the interval Tor logs its heartbeat at (HeartbeatPeriod),
+	// see Tor.Heartbeats. If zero, Tor's default of 6 hours is used, otherwise it
+	// must be at least 30 minutes.
+	HeartbeatPeriod time.Duration
+
+	// NoWait, if set, makes Start return as soon as Tor is running and answers
+	// its controller, without waiting for it to bootstrap. The progress can be
+	// followed through the BootstrapEvents of the returned Tor.
+	NoWait bool
+
+	// LogHandler, if set, receives every message Tor logs at or above the level
+	// of Config.LogLevel (notice by default), including the ones emitted during
+	// startup, before the controller is available.
+	LogHandler func(level, msg string)
+
+	// HandleSignals, if set, shuts Tor down gracefully when the process receives
+	// an interrupt (Ctrl-C) or SIGTERM, halting it at once on a second one, so Tor
+	// gets to release its data folder lock and tear down its onion services. Tor's
+	// own signal handlers are disabled in turn, leaving the signals to Go. Done
+	// reports when Tor exited; the Tor still needs to be closed afterwards.
+	HandleSignals bool
+}
+
+// BootstrapStatus is a bootstrap progress report of Tor.
+type BootstrapStatus struct {
+	Percent int    // Bootstrap progress, 100 meaning done
+	Tag     string // Machine readable name of the bootstrap phase (e.g. conn_done)
+	Summary string // Human readable description of the bootstrap phase
+	Warning string // Reason of the bootstrap problem, if one was reported
+}
+
+// parseBootstrap converts a BOOTSTRAP client status into a progress report.
+func parseBootstrap(status *control.StatusEvent) BootstrapStatus {
+	percent, _ := strconv.Atoi(status.Arguments["PROGRESS"])
+	return BootstrapStatus{
+		Percent: percent,
+		Tag:     status.Arguments["TAG"],
+		Summary: status.Arguments["SUMMARY"],
+		Warning: status.Arguments["WARNING"],
+	}
+}
+
+// Tor is an embedded Tor running in-process, along with the owning controller
+// connection to it. It should be created with Start and always be closed when
+// not needed any more.
+type Tor struct {
+	conf    *TorConfig    // Embedded configuration, freed when Tor exits
+	sock    net.Conn      // Owning control socket, Tor exits if it's closed
+	control *control.Conn // Controller speaking over the owning socket
+
+	socks     string // Address of the SOCKS5 proxy (host:port or socket path)
+	network   string // Network of the SOCKS5 proxy address (tcp or unix)
+	ctrl      string // Path of the extra unix control socket, if any
+	dataDir   string // Folder Tor keeps its state in
+	ephemeral bool   // Whether the data folder is to be removed on close
+
+	shutdown time.Duration // Time to wait for a graceful shutdown on close
+
+	transports []*transportProxy // In-process pluggable transports served to Tor
+
+	newnymLock sync.Mutex // Serializes the new identity requests
+	newnym     time.Time  // Time the last new identity took (or takes) effect
+
+	statusLock sync.Mutex     // Protects the recorded client status events
+	statuses   []ClientStatus // Most recent client status events, for Diagnose
+
+	exited  chan struct{} // Closed when tor_run_main returns
+	code    int           // Exit code of tor_run_main, valid after exited
+	handled chan struct{} // Closed when the event dispatcher terminates
+	stop    func()        // Stops the event dispatcher
+	logged  chan struct{} // Closed when all logs are delivered to the handler
+}
+
+// Start launches an embedded Tor in a background goroutine and waits for it to
+// bootstrap, returning once it's able to build circuits. If Tor dies during the
+// startup instead, Start returns as soon as it exited, with a *TorExitError for
+// a non-zero exit code. If ctx is nil, the background context is used; if conf
+// is nil, Tor's defaults are used.
+func Start(ctx context.Context, conf *StartConf) (*Tor, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if conf == nil {
+		conf = new(StartConf)
+	}
+	config := conf.Config
+	if config == nil {
+		config = new(Config)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := seedRNG(config); err != nil {
+		return nil, err
+	}
+	if conf.SocksPort < 0 || conf.SocksPort > 65535 {
+		return nil, fmt.Errorf("invalid SocksPort: %d", conf.SocksPort)
+	}
+	if conf.SocksPort != 0 && conf.SocksSocket != "" {
+		return nil, errors.New("SocksPort and SocksSocket are mutually exclusive")
+	}
+	for _, path := range []string{conf.SocksSocket, conf.ControlSocket} {
+		if path == "" {
+			continue
+		}
+		if err := prepareSocketDir(path); err != nil {
+			return nil, err
+		}
+	}
+	transports := make(map[string]ClientTransport)
+	for name, transport := range conf.Transports {
+		if !validTransportName(name) || transport == nil {
+			return nil, fmt.Errorf("invalid transport: %q", name)
+		}
+		transports[name] = transport
+	}
+	if conf.UseObfs4 {
+		if conf.Obfs4 == nil {
+			return nil, errors.New("UseObfs4 needs an obfs4 implementation in Obfs4")
+		}
+		if _, ok := transports["obfs4"]; ok {
+			return nil, errors.New("obfs4 transport set both via Obfs4 and Transports")
+		}
+		transports["obfs4"] = conf.Obfs4
+	}
+	if conf.DisableIPv6 && conf.PreferIPv6 {
+		return nil, errors.New("DisableIPv6 and PreferIPv6 are mutually exclusive")
+	}
+	if len(conf.FallbackBridges) > 0 {
+		if len(conf.Bridges) > 0 {
+			return nil, errors.New("FallbackBridges and Bridges are mutually exclusive")
+		}
+		if conf.NoWait {
+			return nil, errors.New("FallbackBridges need Start to wait for the bootstrap, not NoWait")
+		}
+	}
+	limits := []struct {
+		name string
+		rate uint64
+	}{
+		{"BandwidthRate", conf.BandwidthRate},
+		{"BandwidthBurst", conf.BandwidthBurst},
+		{"RelayBandwidthRate", conf.RelayBandwidthRate},
+	}
+	for _, limit := range limits {
+		if limit.rate > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid %s: %d bytes/s, at most %d allowed", limit.name, limit.rate, math.MaxInt32)
+		}
+	}
+	if conf.BandwidthRate != 0 && conf.BandwidthBurst != 0 && conf.BandwidthBurst < conf.BandwidthRate {
+		return nil, fmt.Errorf("BandwidthBurst (%d) below BandwidthRate (%d)", conf.BandwidthBurst, conf.BandwidthRate)
+	}
+	if conf.DormantTimeout != 0 && conf.DormantTimeout < minDormantTimeout {
+		return nil, fmt.Errorf("invalid DormantTimeout: %v, want at least %v", conf.DormantTimeout, minDormantTimeout)
+	}
+	if conf.HeartbeatPeriod != 0 && conf.HeartbeatPeriod < minHeartbeatPeriod {
+		return nil, fmt.Errorf("invalid HeartbeatPeriod: %v, want at least %v", conf.HeartbeatPeriod, minHeartbeatPeriod)
+	}
+	if conf.FallbackAfter < 0 {
+		return nil, fmt.Errorf("invalid FallbackAfter: %v", conf.FallbackAfter)
+	}
+	for _, bridges := range [][]string{conf.Bridges, conf.FallbackBridges} {
+		for _, bridge := range bridges {
+			if strings.TrimSpace(bridge) == "" || strings.ContainsAny(bridge, "\r\n") {
+				return nil, fmt.Errorf("invalid bridge line: %q", bridge)
+			}
+		}
+	}
+	// Tor can't run concurrently with itself, reserve it for this instance
+	if err := acquire(); err != nil {
+		return nil, err
+	}
+	t := &Tor{
+		network:   "tcp",
+		ctrl:      conf.ControlSocket,
+		dataDir:   conf.DataDir,
+		ephemeral: conf.EphemeralData,
+		shutdown:  config.shutdownTimeout(),
+		exited:    make(chan struct{}),
+		handled:   make(chan struct{}),
+		logged:    make(chan struct{}),
+	}
+	if t.dataDir == "" {
+		dir, err := ioutil.TempDir("", "libtor-")
+		if err != nil {
+			release()
+			return nil, err
+		}
+		t.dataDir, t.ephemeral = dir, true
+	} else if err := checkDataDirLock(t.dataDir, conf.StealDataDirLock); err != nil {
+		release()
+		return nil, err
+	}
+	// Assemble the command line, ignoring any system wide torrc
+	torrc := []string{"-f", filepath.Join(t.dataDir, "torrc"), "--ignore-missing-torrc"}
+	if conf.Torrc != "" || len(conf.Options) > 0 {
+		path := filepath.Join(t.dataDir, "libtor-torrc")
+		if err := writeTorrc(path, conf.Torrc, conf.Options); err != nil {
+			t.cleanup()
+			release()
+			return nil, err
+		}
+		torrc = []string{"-f", path}
+	}
+	socks := "auto"
+	if conf.SocksPort != 0 {
+		socks = strconv.Itoa(conf.SocksPort)
+	}
+	listener := "127.0.0.1:" + socks
+	if conf.SocksSocket != "" {
+		listener = "unix:" + strconv.Quote(conf.SocksSocket)
+		t.socks, t.network = conf.SocksSocket, "unix"
+	}
+	args := append(torrc,
+		"--DataDirectory", t.dataDir,
+		"--SocksPort", listener,
+	)
+	if conf.ControlSocket != "" {
+		args = append(args, "--ControlSocket", conf.ControlSocket, "--CookieAuthentication", "1")
+	}
+	if len(conf.Bridges) > 0 {
+		args = append(args, "--UseBridges", "1")
+		for _, bridge := range conf.Bridges {
+			args = append(args, "--+Bridge", bridge)
+		}
+	}
+	for _, limit := range limits {
+		if limit.rate != 0 {
+			args = append(args, "--"+limit.name, strconv.FormatUint(limit.rate, 10)+" bytes")
+		}
+	}
+	if conf.DormantTimeout != 0 {
+		args = append(args, "--DormantClientTimeout", strconv.Itoa(int(conf.DormantTimeout/time.Second))+" seconds")
+	}
+	if conf.HandleSignals {
+		args = append(args, "--__DisableSignalHandlers", "1")
+	}
+	if conf.HeartbeatPeriod != 0 {
+		args = append(args, "--HeartbeatPeriod", strconv.Itoa(int(conf.HeartbeatPeriod/time.Second))+" seconds")
+	}
+	switch {
+	case conf.DisableIPv6:
+		args = append(args, "--ClientUseIPv4", "1", "--ClientUseIPv6", "0", "--ClientPreferIPv6ORPort", "0")
+	case conf.PreferIPv6:
+		args = append(args, "--ClientUseIPv6", "1", "--ClientPreferIPv6ORPort", "1")
+	}
+	// Serve the in-process transports to Tor through local SOCKS5 proxies
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		proxy, err := launchTransport(transports[name], &TransportEnv{
+			Name:     name,
+			StateDir: filepath.Join(t.dataDir, "pt_state", name),
+		})
+		if err != nil {
+			t.cleanup()
+			release()
+			return nil, err
+		}
+		t.transports = append(t.transports, proxy)
+		args = append(args, "--ClientTransportPlugin", name+" socks5 "+proxy.addr())
+	}
+	args = append(args, config.Args()...)
+
+	// Point Tor to the embedded GeoIP databases, unless configured explicitly
+	if !hasGeoIPArgs(config.ExtraArgs) && !hasGeoIPOptions(conf.Torrc, conf.Options) {
+		geoip, geoip6, err := WriteGeoIPFiles(t.dataDir)
+		switch {
+		case err == nil:
+			args = append(args, "--GeoIPFile", geoip, "--GeoIPv6File", geoip6)
+		case err != ErrNoGeoIP:
+			t.cleanup()
+			release()
+			return nil, err
+		}
+	}
+
+	// If logs were requested, have Tor write them into a file and follow it. Tor
+	// queues the startup messages until its logs are configured, so none of them
+	// are lost, contrary to subscribing to log events over the controller.
+	var logs *os.File
+	if conf.LogHandler != nil {
+		path := filepath.Join(t.dataDir, "libtor.log")
+
+		// Start with an empty log, Tor appends to any previous one
+		os.Remove(path)
+
+		var err error
+		if logs, err = os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600); err != nil {
+			t.cleanup()
+			release()
+			return nil, err
+		}
+		level := config.LogLevel
+		if level == "" {
+			level = "notice"
+		}
+		args = append(args, "--Log", level+" file "+path)
+	} else {
+		close(t.logged)
+	}
+
+	// Create the embedded configuration along with the owning controller
+	cfg, err := NewConfig()
+	if err != nil {
+		closeLogs(logs)
+		t.cleanup()
+		release()
+		return nil, err
+	}
+	if err := cfg.SetCommandLine(args); err != nil {
+		cfg.Free()
+		closeLogs(logs)
+		t.cleanup()
+		release()
+		return nil, err
+	}
+	sock, err := cfg.ControlSocket()
+	if err != nil {
+		cfg.Free()
+		closeLogs(logs)
+		t.cleanup()
+		release()
+		return nil, err
+	}
+	t.conf, t.sock = cfg, sock
+	t.control = control.NewConn(textproto.NewConn(sock))
+	t.control.Authenticated = true // Owning control sockets are pre-authenticated
+
+	// Run Tor and dispatch the asynchronous control events until it terminates
+	go func() {
+		t.code = runMain(cfg)
+		release()
+		close(t.exited)
+	}()
+	events, stop := context.WithCancel(context.Background())
+	t.stop = stop
+	go func() {
+		t.control.HandleEvents(events)
+		close(t.handled)
+	}()
+	if logs != nil {
+		go t.followLogs(logs, conf.LogHandler)
+	}
+	if conf.HandleSignals {
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go t.handleSignals(signals)
+	}
+	// Wait for Tor to be up and running, or to die trying, before talking to it
+	if err := t.waitRunning(ctx); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if err := t.recordStatus(); err != nil {
+		t.Close()
+		return nil, err
+	}
+	// Wait for Tor to bootstrap and find out where it's listening
+	if !conf.NoWait {
+		after := conf.FallbackAfter
+		if after == 0 {
+			after = defaultFallbackAfter
+		}
+		if err := t.bootstrap(ctx, conf.FallbackBridges, after); err != nil {
+			// Collect what went wrong while Tor is still around to ask
+			var failed *BootstrapError
+			if errors.As(err, &failed) {
+				failed.Diagnostics, _ = t.Diagnose()
+			}
+			t.Close()
+			return nil, err
+		}
+	}
+	if t.network == "tcp" {
+		if t.socks, err = t.socksAddr(); err != nil {
+			t.Close()
+			return nil, err
+		}
+	} else {
+		// Tor only answers the controller once its listeners are open
+		if _, err = t.control.GetInfo("net/listeners/socks"); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	// Tor leaves the unix socket permissions to the umask, restrict them
+	for _, path := range []string{conf.SocksSocket, conf.ControlSocket} {
+		if path == "" {
+			continue
+		}
+		if err := secureSocket(path); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// prepareSocketDir ensures the folder of a unix socket exists and is private to
+// the user, as Tor refuses to create sockets in folders others can access.
+func prepareSocketDir(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("unix socket folder %s is accessible by others (%v)", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// secureSocket restricts a unix socket created by Tor to its owner and verifies
+// that the permissions stuck.
+func secureSocket(path string) error {
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a unix socket", path)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("unix socket %s is accessible by others (%v)", path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// bootstrap waits until Tor reports it finished bootstrapping, failing if Tor
+// exits, reports a bootstrap error or the context is cancelled. If fallback
+// bridges are given, Tor is switched over to them once the bootstrap made no
+// progress for the given time.
+func (t *Tor) bootstrap(ctx context.Context, fallback []string, after time.Duration) error {
+	events, unsubscribe, err := t.subscribe(control.EventCodeStatusClient)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	// Bootstrapping might have progressed before subscribing, check it first
+	info, err := t.control.GetInfo("status/bootstrap-phase")
+	if err != nil {
+		return err
+	}
+	var last BootstrapStatus
+	if len(info) == 1 {
+		status := control.ParseStatusEvent(control.EventCodeStatusClient, info[0].Val)
+		if status.Action == "BOOTSTRAP" {
+			last = parseBootstrap(status)
+		}
+		if done, err := bootstrapped(status); done || err != nil {
+			return failedBootstrap(err, last)
+		}
+	}
+	// If there's a fallback, watch out for the bootstrap stalling
+	var (
+		stall   *time.Timer
+		stalled <-chan time.Time
+	)
+	if len(fallback) > 0 {
+		stall = time.NewTimer(after)
+		defer stall.Stop()
+		stalled = stall.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return &BootstrapError{Err: ctx.Err(), Last: last}
+
+		case <-stalled:
+			if err := t.useBridges(fallback); err != nil {
+				return err
+			}
+			stall, stalled = nil, nil
+
+		case <-t.exited:
+			return t.exitErr()
+
+		case event := <-events:
+			status, ok := event.(*control.StatusEvent)
+			if !ok {
+				continue
+			}
+			if status.Action == "BOOTSTRAP" {
+				progress := parseBootstrap(status)
+				if stall != nil && progress.Percent > last.Percent {
+					if !stall.Stop() {
+						<-stall.C
+					}
+					stall.Reset(after)
+				}
+				last = progress
+			}
+			if done, err := bootstrapped(status); done || err != nil {
+				return failedBootstrap(err, last)
+			}
+		}
+	}
+}
+
+// useBridges reconfigures Tor to connect to the network through the given bridges
+// instead of the public relays, restarting the bootstrap.
+func (t *Tor) useBridges(bridges []string) error {
+	entries := []*control.KeyVal{control.NewKeyVal("UseBridges", "1")}
+	for _, bridge := range bridges {
+		entries = append(entries, control.NewKeyVal("Bridge", bridge))
+	}
+	if err := t.control.SetConf(entries...); err != nil {
+		return fmt.Errorf("failed to switch to fallback bridges: %v", err)
+	}
+	return nil
+}
+
+// BootstrapError is returned by Start if Tor reports a bootstrap failure, or its
+// context is cancelled or times out before Tor finished bootstrapping, reporting
+// how far it got, e.g. to decide on falling back to bridges when stuck connecting
+// to the network.
+type BootstrapError struct {
+	Err  error           // Context error or failure that aborted the wait
+	Last BootstrapStatus // Last bootstrap progress reported by Tor
+
+	// Diagnostics is what Tor reported about its connection to the network right
+	// before it was torn down, nil if it didn't answer its controller yet.
+	Diagnostics *BootstrapDiagnostics
+}
+
+// Error implements error, including the phase Tor was stuck in.
+func (e *BootstrapError) Error() string {
+	if e.Last.Tag == "" {
+		return fmt.Sprintf("bootstrap not started: %v", e.Err)
+	}
+	return fmt.Sprintf("bootstrap stuck at %d%% (%s: %s): %v", e.Last.Percent, e.Last.Tag, e.Last.Summary, e.Err)
+}
+
+// Unwrap returns the context error, so errors.Is(err, context.DeadlineExceeded)
+// works as for a plain context error.
+func (e *BootstrapError) Unwrap() error {
+	return e.Err
+}
+
+// failedBootstrap wraps a bootstrap failure reported by Tor into a BootstrapError,
+// passing anything else through.
+func failedBootstrap(err error, last BootstrapStatus) error {
+	if err == nil {
+		return nil
+	}
+	return &BootstrapError{Err: err, Last: last}
+}
+
+// waitRunning waits until Tor answers on the owning controller, which it only does
+// once it set itself up and entered its main loop, or until it exits during the
+// startup (e.g. on an invalid configuration), whichever happens first. Either may
+// happen in a split second, so both are raced instead of assuming any order.
+func (t *Tor) waitRunning(ctx context.Context) error {
+	answered := make(chan error, 1)
+	go func() {
+		_, err := t.control.GetInfo("version")
+		answered <- err
+	}()
+	select {
+	case err := <-answered:
+		if err == nil {
+			return nil
+		}
+		// The controller failing means Tor is going away, report why if it does
+		select {
+		case <-t.exited:
+			return t.exitErr()
+		case <-time.After(haltTimeout):
+			return fmt.Errorf("embedded tor not responding: %v", err)
+		}
+
+	case <-t.exited:
+		return t.exitErr()
+
+	case <-ctx.Done():
+		return &BootstrapError{Err: ctx.Err()}
+	}
+}
+
+// exitErr reports why Tor exited before it was asked to, which is an error even
+// if its exit code says otherwise.
+func (t *Tor) exitErr() error {
+	if t.code != 0 {
+		return &TorExitError{Code: t.code}
+	}
+	return errors.New("embedded tor exited unexpectedly")
+}
+
+// bootstrapped checks whether a status event reports that Tor has finished
+// bootstrapping, or that it failed doing so.
+func bootstrapped(status *control.StatusEvent) (bool, error) {
+	if status.Action != "BOOTSTRAP" {
+		return false, nil
+	}
+	if status.Severity == "ERR" {
+		return false, fmt.Errorf("bootstrap failed: %s", status.Arguments["WARNING"])
+	}
+	return status.Arguments["PROGRESS"] == "100", nil
+}
+
+// followLogs reads the log messages Tor writes into a file and passes them to
+// the handler, until Tor exits and the file is fully consumed.
+func (t *Tor) followLogs(logs *os.File, handler func(level, msg string)) {
+	defer close(t.logged)
+	defer logs.Close()
+
+	var (
+		reader  = bufio.NewReader(logs)
+		partial string
+	)
+	for {
+		// If Tor already exited, whatever is read now is the last of the logs
+		var done bool
+		select {
+		case <-t.exited:
+			done = true
+		default:
+		}
+		line, err := reader.ReadString('\n')
+		if partial += line; err == nil {
+			deliverLog(handler, partial)
+			partial = ""
+			continue
+		}
+		if done {
+			if partial != "" {
+				deliverLog(handler, partial)
+			}
+			return
+		}
+		// Reached the end of what Tor wrote so far, wait for more
+		select {
+		case <-t.exited:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// deliverLog strips the timestamp from a line of Tor's logs and passes it to the
+// handler, split into the severity and the message.
+func deliverLog(handler func(level, msg string), line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if start := strings.Index(line, " ["); start >= 0 {
+		if end := strings.Index(line[start:], "] "); end >= 0 {
+			handler(line[start+2:start+end], line[start+end+2:])
+			return
+		}
+	}
+	handler("", line)
+}
+
+// closeLogs closes the log file if there's one.
+func closeLogs(logs *os.File) {
+	if logs != nil {
+		logs.Close()
+	}
+}
+
+// BootstrapEvents returns a channel reporting the bootstrap progress of Tor,
+// starting with the current state. The channel is closed when bootstrapping
+// completes or Tor exits. Progress reports are dropped, keeping the latest ones,
+// if the channel is not drained fast enough.
+func (t *Tor) BootstrapEvents() <-chan BootstrapStatus {
+	statuses := make(chan BootstrapStatus, 16)
+
+	events, unsubscribe, err := t.subscribe(control.EventCodeStatusClient)
+	if err != nil {
+		close(statuses)
+		return statuses
+	}
+	report := func(status *control.StatusEvent) bool {
+		if status.Action != "BOOTSTRAP" {
+			return false
+		}
+		progress := parseBootstrap(status)
+		for {
+			select {
+			case statuses <- progress:
+				return progress.Percent == 100
+			default:
+				// Nobody's reading, drop the oldest report to make room
+				select {
+				case <-statuses:
+				default:
+				}
+			}
+		}
+	}
+	go func() {
+		defer close(statuses)
+		defer unsubscribe()
+
+		// Bootstrapping might have progressed before subscribing, report it first
+		info, err := t.control.GetInfo("status/bootstrap-phase")
+		if err != nil {
+			return
+		}
+		if len(info) == 1 && report(control.ParseStatusEvent(control.EventCodeStatusClient, info[0].Val)) {
+			return
+		}
+		for {
+			select {
+			case <-t.exited:
+				return
+
+			case event := <-events:
+				if status, ok := event.(*control.StatusEvent); ok && report(status) {
+					return
+				}
+			}
+		}
+	}()
+	return statuses
+}
+
+// socksAddr retrieves the address of the TCP SOCKS listener of Tor. If there are
+// several (e.g. extra ones set via Config.ExtraArgs), the first one on 127.0.0.1
+// is preferred, otherwise the first TCP one. Unix socket listeners are skipped.
+func (t *Tor) socksAddr() (string, error) {
+	info, err := t.control.GetInfo("net/listeners/socks")
+	if err != nil {
+		return "", err
+	}
+	if len(info) != 1 {
+		return "", errors.New("unable to get socks listeners")
+	}
+	var fallback string
+	for _, addr := range strings.Fields(info[0].Val) {
+		addr = strings.Trim(addr, `"`)
+		if strings.HasPrefix(addr, "unix:") {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			continue
+		}
+		if host == "127.0.0.1" {
+			return addr, nil
+		}
+		if fallback == "" {
+			fallback = addr
+		}
+	}
+	if fallback == "" {
+		return "", fmt.Errorf("no tcp socks listener: %s", info[0].Val)
+	}
+	return fallback, nil
+}
+
+// SocksPort returns the port the SOCKS5 proxy of Tor is listening on, which is
+// only known after startup if Tor picked it (StartConf.SocksPort zero). Tor is
+// queried for its current listeners, so the result reflects any reconfiguration
+// since Start.
+func (t *Tor) SocksPort() (int, error) {
+	addr, err := t.socksAddr()
+	if err != nil {
+		return 0, err
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(port)
+}
+
+// subscribe registers for a set of asynchronous control events, returning the
+// channel they are delivered on and a function to unregister.
+func (t *Tor) subscribe(codes ...control.EventCode) (<-chan control.Event, func(), error) {
+	events := make(chan control.Event, 16)
+	if err := t.control.AddEventListener(events, codes...); err != nil {
+		return nil, nil, err
+	}
+	unsubscribe := func() {
+		t.control.RemoveEventListener(events, codes...)
+
+		// An event might be in flight already, drain until dispatching stops
+		go func() {
+			for {
+				select {
+				case <-events:
+				case <-t.handled:
+					return
+				}
+			}
+		}()
+	}
+	return events, unsubscribe, nil
+}
+
+// Control returns the owning controller connection of the embedded Tor. Closing
+// it makes Tor exit.
+func (t *Tor) Control() *control.Conn {
+	return t.control
+}
+
+// Dialer returns a SOCKS5 dialer routing connections through the embedded Tor.
+func (t *Tor) Dialer() (proxy.Dialer, error) {
+	select {
+	case <-t.exited:
+		return nil, errors.New("embedded tor not running")
+	default:
+	}
+	return proxy.SOCKS5(t.network, t.socks, nil, proxy.Direct)
+}
+
+// IsolatedDialer returns a SOCKS5 dialer routing connections through the embedded
+// Tor on circuits of their own, isolated from the ones of any other credentials.
+// The user and password (1 to 255 bytes each) are only used by Tor to tell the
+// streams apart (IsolateSOCKSAuth, on by default), so e.g. one random pair per
+// identity keeps their traffic on separate circuits and exits. Connections made
+// with the same credentials may share circuits. The isolation is lost if the
+// SocksPort is configured with NoIsolateSOCKSAuth via Options or ExtraArgs.
+func (t *Tor) IsolatedDialer(user, pass string) (proxy.Dialer, error) {
+	if len(user) == 0 || len(user) > 255 || len(pass) == 0 || len(pass) > 255 {
+		return nil, errors.New("invalid isolation credentials: want 1 to 255 bytes each")
+	}
+	select {
+	case <-t.exited:
+		return nil, errors.New("embedded tor not running")
+	default:
+	}
+	return proxy.SOCKS5(t.network, t.socks, &proxy.Auth{User: user, Password: pass}, proxy.Direct)
+}
+
+// TrafficStats returns the total number of bytes Tor read from and wrote to the
+// network since it started (GETINFO traffic/read and traffic/written).
+func (t *Tor) TrafficStats() (read, written uint64, err error) {
+	info, err := t.control.GetInfo("traffic/read", "traffic/written")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, kv := range info {
+		var counter *uint64
+		switch kv.Key {
+		case "traffic/read":
+			counter = &read
+		case "traffic/written":
+			counter = &written
+		default:
+			continue
+		}
+		if *counter, err = strconv.ParseUint(kv.Val, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("malformed %s: %q", kv.Key, kv.Val)
+		}
+	}
+	return read, written, nil
+}
+
+// ConsensusStatus describes how current Tor's view of the network is: the validity
+// of its latest consensus and what the network thinks of its version.
+type ConsensusStatus struct {
+	ValidAfter time.Time // Start of the consensus validity, zero if there's none
+	FreshUntil time.Time // Time a newer consensus is expected to be published by
+	ValidUntil time.Time // End of the consensus validity
+	Live       bool      // Whether the consensus is valid right now
+
+	// VersionStatus is Tor's own version judged by the consensus: recommended,
+	// new, new in series, obsolete, unrecommended, none recommended or unknown.
+	VersionStatus string
+}
+
+// consensusTimeLayout is the format of the consensus times reported by Tor, in UTC.
+const consensusTimeLayout = "2006-01-02 15:04:05"
+
+// ConsensusInfo reports the validity of the latest consensus Tor has (GETINFO
+// consensus/valid-after, fresh-until and valid-until) along with the status of
+// its version (status/version/current). Without any consensus (e.g. before the
+// first bootstrap), the times are left zero. Tor keeps using an expired consensus
+// for up to a day while trying to fetch a new one, so an outdated one is worth
+// warning about, but doesn't necessarily mean Tor stopped working.
+func (t *Tor) ConsensusInfo() (*ConsensusStatus, error) {
+	info, err := t.control.GetInfo("status/version/current")
+	if err != nil {
+		return nil, err
+	}
+	status := new(ConsensusStatus)
+	for _, kv := range info {
+		if kv.Key == "status/version/current" {
+			status.VersionStatus = kv.Val
+		}
+	}
+	info, err = t.control.GetInfo("consensus/valid-after", "consensus/fresh-until", "consensus/valid-until")
+	if err != nil {
+		// Tor rejects the queries altogether if it has no consensus yet
+		var rejected *textproto.Error
+		if errors.As(err, &rejected) && rejected.Code == control.StatusErrInternalError {
+			return status, nil
+		}
+		return nil, err
+	}
+	for _, kv := range info {
+		var field *time.Time
+		switch kv.Key {
+		case "consensus/valid-after":
+			field = &status.ValidAfter
+		case "consensus/fresh-until":
+			field = &status.FreshUntil
+		case "consensus/valid-until":
+			field = &status.ValidUntil
+		default:
+			continue
+		}
+		if *field, err = time.ParseInLocation(consensusTimeLayout, kv.Val, time.UTC); err != nil {
+			return nil, fmt.Errorf("malformed %s: %q", kv.Key, kv.Val)
+		}
+	}
+	now := time.Now()
+	status.Live = !now.Before(status.ValidAfter) && now.Before(status.ValidUntil)
+
+	return status, nil
+}
+
+// Dormant puts Tor to sleep (SIGNAL DORMANT), stopping its network activity to
+// save battery and bandwidth, e.g. when a mobile app goes to the background. The
+// circuits are left to expire and no new ones are built until Tor is woken up by
+// Active, or by a new client request on its SOCKS port.
+func (t *Tor) Dormant() error {
+	if err := t.control.Signal("DORMANT"); err != nil {
+		return fmt.Errorf("failed to make tor dormant: %v", err)
+	}
+	return nil
+}
+
+// Active wakes Tor up from dormant mode (SIGNAL ACTIVE), e.g. when a mobile app
+// comes back to the foreground, so circuits are ready before the first request.
+// It's a noop if Tor isn't dormant.
+func (t *Tor) Active() error {
+	if err := t.control.Signal("ACTIVE"); err != nil {
+		return fmt.Errorf("failed to make tor active: %v", err)
+	}
+	return nil
+}
+
+// DialControl opens a new, authenticated control connection to Tor over the unix
+// control socket set via StartConf.ControlSocket. Contrary to the owning one,
+// closing it leaves Tor running.
+func (t *Tor) DialControl() (*ControlConn, error) {
+	if t.ctrl == "" {
+		return nil, errors.New("no control socket configured")
+	}
+	conn, err := net.Dial("unix", t.ctrl)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := NewControlConn(conn)
+	if err := ctrl.Authenticate(); err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+	return ctrl, nil
+}
+
+// NewIdentity requests a fresh identity from Tor (SIGNAL NEWNYM): new requests
+// are routed over clean circuits and its DNS cache is cleared. Tor rate limits
+// these to one per NewIdentityRateLimit, delaying any requested sooner, in which
+// case ErrNewIdentityRateLimited is returned. Only the requests made via this
+// method are accounted for, not those sent by other controllers.
+func (t *Tor) NewIdentity() error {
+	t.newnymLock.Lock()
+	defer t.newnymLock.Unlock()
+
+	return t.signalNewIdentity()
+}
+
+// NewIdentityWait requests a fresh identity from Tor like NewIdentity, but if
+// the previous one was requested within NewIdentityRateLimit, waits for the
+// interval to pass first, so the new identity is in effect once it returns.
+func (t *Tor) NewIdentityWait(ctx context.Context) error {
+	for {
+		t.newnymLock.Lock()
+		wait := time.Until(t.newnym.Add(NewIdentityRateLimit))
+		if wait <= 0 {
+			err := t.signalNewIdentity()
+			t.newnymLock.Unlock()
+			return err
+		}
+		t.newnymLock.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-t.exited:
+			timer.Stop()
+			return errors.New("embedded tor not running")
+		}
+	}
+}
+
+// signalNewIdentity sends a NEWNYM signal to Tor, tracking when it takes effect
+// the same way Tor does. The caller must hold newnymLock.
+func (t *Tor) signalNewIdentity() error {
+	if err := t.control.Signal("NEWNYM"); err != nil {
+		return fmt.Errorf("failed to request new identity: %v", err)
+	}
+	now := time.Now()
+	switch {
+	case now.Sub(t.newnym) >= NewIdentityRateLimit:
+		t.newnym = now
+		return nil
+	case !t.newnym.After(now):
+		// Tor schedules the request for when the interval passes
+		t.newnym = t.newnym.Add(NewIdentityRateLimit)
+	}
+	return ErrNewIdentityRateLimited
+}
+
+// Done returns a channel that's closed when Tor exits, be it due to Close, a
+// signal (see StartConf.HandleSignals) or a fatal error.
+func (t *Tor) Done() <-chan struct{} {
+	return t.exited
+}
+
+// handleSignals shuts Tor down gracefully on the first signal received, halting
+// it by dropping the owning controller on a second one or if it doesn't exit in
+// time, until Tor exits.
+func (t *Tor) handleSignals(signals chan os.Signal) {
+	defer signal.Stop(signals)
+
+	select {
+	case <-signals:
+	case <-t.exited:
+		return
+	}
+	// Don't block on the reply, a stuck Tor might never send one
+	go t.control.Signal("SHUTDOWN")
+
+	select {
+	case <-signals:
+	case <-time.After(t.shutdown):
+	case <-t.exited:
+		return
+	}
+	t.sock.Close()
+}
+
+// Close shuts down the embedded Tor. It first requests a graceful shutdown and
+// if Tor doesn't exit within Config.ShutdownTimeout, halts it by dropping the
+// owning controller. Tor runs on a thread of this process, so if even that
+// fails, it can't be killed.
+func (t *Tor) Close() error {
+	var err error
+	select {
+	case <-t.exited:
+	default:
+		// Don't block on the reply, a stuck Tor might never send one
+		go t.control.Signal("SHUTDOWN")
+
+		select {
+		case <-t.exited:
+		case <-time.After(t.shutdown):
+			// Graceful shutdown timed out, drop the owning controller to halt
+			t.sock.Close()
+
+			select {
+			case <-t.exited:
+			case <-time.After(haltTimeout):
+				err = errors.New("embedded tor did not exit")
+			}
+		}
+	}
+	t.stop()
+	t.sock.Close()
+
+	// Only release the resources if Tor is not using them any more
+	if err == nil {
+		<-t.logged
+		t.conf.Free()
+		err = t.cleanup()
+	}
+	return err
+}
+
+// cleanup stops the in-process transports and removes the data folder if it was
+// a temporary or ephemeral one.
+func (t *Tor) cleanup() error {
+	for _, proxy := range t.transports {
+		proxy.close()
+	}
+	if !t.ephemeral {
+		return nil
+	}
+	// Some platforms (Windows) refuse to delete files that still have handles
+	// open, which Tor's worker threads or virus scanners may hold for a moment
+	// after it exited, so retry for a while
+	var err error
+	for i := 0; i < dataDirRemoveAttempts; i++ {
+		if err = os.RemoveAll(t.dataDir); err == nil {
+			return nil
+		}
+		time.Sleep(dataDirRemoveBackoff)
+	}
+	return fmt.Errorf("failed to remove data folder: %v", err)
+}
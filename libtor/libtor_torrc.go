@@ -0,0 +1,76 @@
+package libtor
+
+// This file contains the rendering of the torrc file the embedded Tor is started
+// with, for consumers configuring it with raw torrc directives instead of (or on
+// top of) the typed configuration.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// renderTorrc assembles a torrc out of its raw content and a set of additional
+// options, appended in a stable order after it. Every value of an option becomes
+// a separate line, which for the repeatable ones (e.g. Bridge) adds up.
+func renderTorrc(torrc string, options map[string][]string) (string, error) {
+	var b strings.Builder
+
+	b.WriteString(torrc)
+	if torrc != "" && !strings.HasSuffix(torrc, "\n") {
+		b.WriteString("\n")
+	}
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		if key == "" || strings.ContainsAny(key, " \t\r\n#\"\\") {
+			return "", fmt.Errorf("invalid torrc option: %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range options[key] {
+			line, err := torrcLine(key, value)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// torrcLine formats a single torrc directive, quoting the value if Tor would not
+// read it back verbatim otherwise: if it has comment marks, quotes, escapes or
+// surrounding whitespace.
+func torrcLine(key, value string) (string, error) {
+	for _, r := range value {
+		if r < ' ' && r != '\t' || r == 0x7f {
+			return "", fmt.Errorf("invalid value for torrc option %s: %q", key, value)
+		}
+	}
+	if value == "" {
+		return key, nil
+	}
+	if strings.TrimSpace(value) == value && !strings.ContainsAny(value, "#\"\\") {
+		return key + " " + value, nil
+	}
+	// Quoted values are unescaped C style, so only the quotes and escapes need it
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return key + ` "` + quoted + `"`, nil
+}
+
+// writeTorrc renders the torrc of the embedded Tor into path, readable only by
+// the user as it may hold secrets (e.g. HashedControlPassword, client keys).
+func writeTorrc(path, torrc string, options map[string][]string) error {
+	blob, err := renderTorrc(torrc, options)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, []byte(blob), 0600); err != nil {
+		return fmt.Errorf("failed to write torrc: %v", err)
+	}
+	return nil
+}
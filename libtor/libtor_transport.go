@@ -0,0 +1,423 @@
+package libtor
+
+// This file contains the plumbing to run pluggable transports in-process, next
+// to the embedded Tor, instead of as separate managed executables. Tor reaches
+// them through a local SOCKS5 proxy, as with ClientTransportPlugin <name> socks5.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ClientTransport is the client side of a pluggable transport (e.g. obfs4) living
+// in-process. Tor hands it the connections to bridges using the transport, along
+// with the parameters of their bridge lines.
+type ClientTransport interface {
+	// Dial connects to a bridge through the transport. The args are the key=value
+	// parameters of the bridge line (e.g. cert and iat-mode for obfs4).
+	Dial(network, addr string, args map[string]string) (net.Conn, error)
+}
+
+// TransportLauncher is implemented by ClientTransports needing to be set up before
+// use and torn down afterwards, such as Snowflake with its broker rendezvous. It
+// receives the settings Tor passes to managed transports in TOR_PT_* variables.
+type TransportLauncher interface {
+	ClientTransport
+
+	// Launch prepares the transport before Tor first dials through it.
+	Launch(env *TransportEnv) error
+
+	// Close releases the resources of the transport once Tor stopped.
+	Close() error
+}
+
+// TransportEnv is the environment of a pluggable transport, the in-process
+// counterpart of the TOR_PT_* variables of managed transports.
+type TransportEnv struct {
+	Name     string // Name of the transport (TOR_PT_CLIENT_TRANSPORTS)
+	StateDir string // Folder to persist any state into (TOR_PT_STATE_LOCATION)
+	Proxy    string // Upstream proxy URL to connect through, if any (TOR_PT_PROXY)
+}
+
+// validTransportName reports whether a transport name is acceptable to Tor, which
+// requires them to be C identifiers.
+func validTransportName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// launchTransport sets up a pluggable transport if it needs it, and starts the
+// local SOCKS5 proxy Tor reaches it through.
+func launchTransport(transport ClientTransport, env *TransportEnv) (*transportProxy, error) {
+	if launcher, ok := transport.(TransportLauncher); ok {
+		if err := os.MkdirAll(env.StateDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := launcher.Launch(env); err != nil {
+			return nil, fmt.Errorf("failed to launch %s transport: %v", env.Name, err)
+		}
+	}
+	proxy, err := newTransportProxy(transport)
+	if err != nil {
+		if launcher, ok := transport.(TransportLauncher); ok {
+			launcher.Close()
+		}
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// transportProxy is a local SOCKS5 proxy feeding the connections of Tor into an
+// in-process pluggable transport.
+type transportProxy struct {
+	listener  net.Listener    // Local listener Tor connects to
+	transport ClientTransport // Transport carrying the connections to bridges
+}
+
+// newTransportProxy starts a local SOCKS5 proxy for a pluggable transport on an
+// ephemeral localhost port.
+func newTransportProxy(transport ClientTransport) (*transportProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for transport: %v", err)
+	}
+	p := &transportProxy{
+		listener:  listener,
+		transport: transport,
+	}
+	go p.loop()
+	return p, nil
+}
+
+// addr returns the address of the SOCKS5 proxy to configure Tor with.
+func (p *transportProxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+// close stops accepting connections from Tor and tears down the transport if it
+// was launched. The connections already established are torn down by Tor itself
+// as it exits.
+func (p *transportProxy) close() error {
+	err := p.listener.Close()
+	if launcher, ok := p.transport.(TransportLauncher); ok {
+		if cerr := launcher.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// loop accepts the connections of Tor until the listener is closed.
+func (p *transportProxy) loop() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+// handle serves a single SOCKS5 connection from Tor: it reads the bridge address
+// and arguments, dials the bridge via the transport and shuffles the data.
+func (p *transportProxy) handle(conn net.Conn) {
+	defer conn.Close()
+
+	args, addr, err := readTransportRequest(conn)
+	if err != nil {
+		return
+	}
+	remote, err := p.transport.Dial("tcp", addr, args)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0}) // Connection refused
+		return
+	}
+	defer remote.Close()
+
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// readTransportRequest runs the server side of a SOCKS5 handshake as spoken by
+// Tor to pluggable transports: the bridge line arguments are passed as the
+// username and password, followed by a CONNECT request to the bridge.
+func readTransportRequest(conn net.Conn) (map[string]string, string, error) {
+	// Negotiate the authentication method, username/password if offered
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, "", err
+	}
+	if head[0] != 5 {
+		return nil, "", fmt.Errorf("unsupported socks version: %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, "", err
+	}
+	method := byte(0xff)
+	for _, m := range methods {
+		if m == 2 || (m == 0 && method == 0xff) {
+			method = m
+		}
+	}
+	if _, err := conn.Write([]byte{5, method}); err != nil {
+		return nil, "", err
+	}
+	if method == 0xff {
+		return nil, "", errors.New("no acceptable socks auth method")
+	}
+	// Retrieve the bridge line arguments from the credentials
+	args := make(map[string]string)
+	if method == 2 {
+		auth := make([]byte, 2)
+		if _, err := io.ReadFull(conn, auth); err != nil {
+			return nil, "", err
+		}
+		user := make([]byte, auth[1])
+		if _, err := io.ReadFull(conn, user); err != nil {
+			return nil, "", err
+		}
+		if _, err := io.ReadFull(conn, auth[:1]); err != nil {
+			return nil, "", err
+		}
+		pass := make([]byte, auth[0])
+		if _, err := io.ReadFull(conn, pass); err != nil {
+			return nil, "", err
+		}
+		// An unneeded password is sent as a single NUL byte
+		blob := string(user)
+		if string(pass) != "\x00" {
+			blob += string(pass)
+		}
+		var err error
+		if args, err = parseTransportArgs(blob); err != nil {
+			conn.Write([]byte{1, 1})
+			return nil, "", err
+		}
+		if _, err := conn.Write([]byte{1, 0}); err != nil {
+			return nil, "", err
+		}
+	}
+	// Read the CONNECT request with the address of the bridge
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return nil, "", err
+	}
+	if req[0] != 5 || req[1] != 1 {
+		conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0}) // Command not supported
+		return nil, "", fmt.Errorf("unsupported socks command: %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, "", err
+		}
+		host = net.IP(ip).String()
+	case 4:
+		ip := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, "", err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return nil, "", err
+		}
+		name := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, "", err
+		}
+		host = string(name)
+	default:
+		conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0}) // Address type not supported
+		return nil, "", fmt.Errorf("unsupported socks address type: %d", req[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, "", err
+	}
+	return args, net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// parseTransportArgs splits the semicolon separated key=value bridge arguments,
+// with backslash escaping any special characters within them.
+func parseTransportArgs(blob string) (map[string]string, error) {
+	args := make(map[string]string)
+	if blob == "" {
+		return args, nil
+	}
+	var (
+		key, cur strings.Builder
+		inValue  bool
+		escaped  bool
+	)
+	flush := func() error {
+		if !inValue {
+			return fmt.Errorf("transport argument without value: %q", cur.String())
+		}
+		args[key.String()] = cur.String()
+		key.Reset()
+		cur.Reset()
+		inValue = false
+		return nil
+	}
+	for _, r := range blob {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '=' && !inValue:
+			key.WriteString(cur.String())
+			cur.Reset()
+			inValue = true
+		case r == ';':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if escaped {
+		return nil, errors.New("transport arguments end in an escape")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// ServeManagedTransports runs the process as a managed pluggable transport if it
+// was launched as one by Tor (ClientTransportPlugin <names> exec <binary>), which
+// is handy for a standalone Tor or when the transport must live in a separate
+// process. It speaks the managed proxy protocol: the TOR_PT_* variables select
+// the transports to serve, their SOCKS5 proxies are reported on stdout and the
+// process winds down when Tor closes its stdin or terminates it.
+//
+// If the process wasn't launched by Tor, it returns false straight away, so it's
+// meant to be called first thing from main:
+//
+//	if managed, err := libtor.ServeManagedTransports(transports); managed {
+//		if err != nil {
+//			os.Exit(1)
+//		}
+//		return
+//	}
+func ServeManagedTransports(transports map[string]ClientTransport) (bool, error) {
+	versions := os.Getenv("TOR_PT_MANAGED_TRANSPORT_VER")
+	if versions == "" {
+		return false, nil
+	}
+	supported := false
+	for _, version := range strings.Split(versions, ",") {
+		supported = supported || version == "1"
+	}
+	if !supported {
+		fmt.Println("VERSION-ERROR no-version")
+		return true, fmt.Errorf("unsupported managed transport versions: %s", versions)
+	}
+	fmt.Println("VERSION 1")
+
+	requested := os.Getenv("TOR_PT_CLIENT_TRANSPORTS")
+	if requested == "" {
+		fmt.Println("ENV-ERROR no TOR_PT_CLIENT_TRANSPORTS environment variable")
+		return true, errors.New("only client transports are supported")
+	}
+	var names []string
+	if requested == "*" {
+		for name := range transports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else {
+		names = strings.Split(requested, ",")
+	}
+	// Transports can only honour an upstream proxy if they get to see it
+	proxy := os.Getenv("TOR_PT_PROXY")
+	if proxy != "" {
+		for _, name := range names {
+			if _, ok := transports[name].(TransportLauncher); transports[name] != nil && !ok {
+				fmt.Println("PROXY-ERROR proxy not supported by " + name)
+				return true, fmt.Errorf("transport %s can't use a proxy", name)
+			}
+		}
+		fmt.Println("PROXY DONE")
+	}
+	var proxies []*transportProxy
+	defer func() {
+		for _, proxy := range proxies {
+			proxy.close()
+		}
+	}()
+	for _, name := range names {
+		transport, ok := transports[name]
+		if !ok {
+			fmt.Println("CMETHOD-ERROR " + name + " no such transport")
+			continue
+		}
+		p, err := launchTransport(transport, &TransportEnv{
+			Name:     name,
+			StateDir: filepath.Join(os.Getenv("TOR_PT_STATE_LOCATION"), name),
+			Proxy:    proxy,
+		})
+		if err != nil {
+			fmt.Println("CMETHOD-ERROR " + name + " " + strings.ReplaceAll(err.Error(), "\n", " "))
+			continue
+		}
+		proxies = append(proxies, p)
+		fmt.Println("CMETHOD " + name + " socks5 " + p.addr())
+	}
+	fmt.Println("CMETHODS DONE")
+
+	// Serve until Tor goes away, by closing stdin if it asked for it, otherwise
+	// by terminating the process
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(done)
+
+	if os.Getenv("TOR_PT_EXIT_ON_STDIN_CLOSE") == "1" {
+		go func() {
+			io.Copy(ioutil.Discard, os.Stdin)
+			done <- syscall.SIGTERM
+		}()
+	}
+	<-done
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package libtor
+
+// This file contains the verification of a Tor configuration without starting Tor,
+// capturing the problems it reports on its console.
+
+/*
+#include <fcntl.h>
+#include <stdio.h>
+#include <stdlib.h>
+#ifdef _WIN32
+#include <io.h>
+#else
+#include <unistd.h>
+#endif
+
+// redirectStdout points the standard output into the given file, returning a
+// duplicate of the original one to restore it with, or -1 on failure.
+static int redirectStdout(const char *path) {
+	int saved, fd;
+
+	fflush(stdout);
+	if ((saved = dup(1)) < 0) {
+		return -1;
+	}
+	if ((fd = open(path, O_WRONLY | O_CREAT | O_TRUNC, 0600)) < 0) {
+		close(saved);
+		return -1;
+	}
+	if (dup2(fd, 1) < 0) {
+		close(fd);
+		close(saved);
+		return -1;
+	}
+	close(fd);
+	return saved;
+}
+
+// restoreStdout points the standard output back to the original one.
+static void restoreStdout(int saved) {
+	fflush(stdout);
+	dup2(saved, 1);
+	close(saved);
+}
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+// VerifyError is returned by VerifyConfig if Tor rejects the configuration.
+type VerifyError struct {
+	Code    int    // Exit code of Tor
+	Message string // First problem reported by Tor, e.g. "Unknown option 'Foo'.  Failing."
+}
+
+// Error implements error, including the problem reported by Tor.
+func (e *VerifyError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("invalid tor configuration (exit code %d)", e.Code)
+	}
+	return "invalid tor configuration: " + e.Message
+}
+
+// VerifyConfig checks whether Tor accepts the given command line arguments (and
+// the torrc they refer to) by running it with --verify-config, which parses and
+// validates the options without starting Tor. If they're invalid, a *VerifyError
+// describes the first problem Tor found. If Tor is already running in the process,
+// ErrAlreadyRunning is returned.
+//
+// Tor reports the problems on the standard output, which is captured for the few
+// milliseconds the verification takes; anything else the process prints in the
+// meantime is swallowed along with them. The verification itself goes through
+// tor_run_main, so a Tor started afterwards is the second run in this process,
+// which upstream warns might misbehave (Tor bug 23847).
+func VerifyConfig(args ...string) error {
+	if err := acquire(); err != nil {
+		return err
+	}
+	defer release()
+
+	dir, err := ioutil.TempDir("", "libtor-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return err
+	}
+	defer cfg.Free()
+
+	if err := cfg.SetCommandLine(append([]string{"--verify-config", "--hush"}, args...)); err != nil {
+		return err
+	}
+	// Capture what Tor prints while verifying, it's the only place it reports to
+	path := filepath.Join(dir, "verify.log")
+
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+
+	saved := C.redirectStdout(cpath)
+	if saved < 0 {
+		return errors.New("failed to capture tor output")
+	}
+	code := runMain(cfg)
+	C.restoreStdout(saved)
+
+	if code == 0 {
+		return nil
+	}
+	output, _ := ioutil.ReadFile(path)
+	return &VerifyError{Code: code, Message: verifyProblem(string(output))}
+}
+
+// verifyProblem extracts the first warning or error from the console output of
+// Tor, stripping the timestamp, the severity and the generic preamble of config
+// failures.
+func verifyProblem(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		for _, severity := range []string{"[warn] ", "[err] "} {
+			idx := strings.Index(line, severity)
+			if idx < 0 {
+				continue
+			}
+			problem := strings.TrimSpace(line[idx+len(severity):])
+			return strings.TrimPrefix(problem, "Failed to parse/validate config: ")
+		}
+	}
+	return ""
+}
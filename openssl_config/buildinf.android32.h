@@ -0,0 +1,35 @@
+/*
+ * WARNING: do not edit!
+ * Generated by util/mkbuildinf.pl
+ *
+ * Copyright 2014-2017 The OpenSSL Project Authors. All Rights Reserved.
+ *
+ * Licensed under the OpenSSL license (the "License").  You may not use
+ * this file except in compliance with the License.  You can obtain a copy
+ * in the file LICENSE in the source distribution or at
+ * https://www.openssl.org/source/license.html
+ */
+
+#define PLATFORM "platform: android-arm"
+#define DATE "built on: Tue May 30 14:43:18 2023 +0200"
+
+/*
+ * Generate compiler_flags as an array of individual characters. This is a
+ * workaround for the situation where CFLAGS gets too long for a C90 string
+ * literal
+ */
+static const char compiler_flags[] = {
+    'c','o','m','p','i','l','e','r',':',' ','c','l','a','n','g',' ',
+    '-','f','P','I','C',' ','-','p','t','h','r','e','a','d',' ','-',
+    'm','a','r','c','h','=','a','r','m','v','7','-','a',' ','-','m',
+    'f','l','o','a','t','-','a','b','i','=','s','o','f','t','f','p',
+    ' ','-','m','f','p','u','=','v','f','p','v','3','-','d','1','6',
+    ' ','-','m','t','h','u','m','b',' ','-','W','a',',','-','-','n',
+    'o','e','x','e','c','s','t','a','c','k',' ','-','Q','u','n','u',
+    's','e','d','-','a','r','g','u','m','e','n','t','s',' ','-','W',
+    'a','l','l',' ','-','O','3',' ','-','D','O','P','E','N','S','S',
+    'L','_','U','S','E','_','N','O','D','E','L','E','T','E',' ','-',
+    'D','O','P','E','N','S','S','L','_','P','I','C',' ','-','D','_',
+    '_','A','N','D','R','O','I','D','_','A','P','I','_','_','=','2',
+    '1',' ','-','D','N','D','E','B','U','G','\0'
+};
@@ -2,14 +2,54 @@
   #include "buildinf.x64.h"
 #endif
 
-#if defined(ARCH_LINUX32) || defined(ARCH_ANDROID32)
+#if defined(ARCH_LINUX32) || defined(ARCH_ANDROID32_X86)
   #include "buildinf.x86.h"
 #endif
 
+#ifdef ARCH_ANDROID32
+  #include "buildinf.android32.h"
+#endif
+
+#ifdef ARCH_LINUX64_MIPS
+  #include "buildinf.mips64.h"
+#endif
+
+#ifdef ARCH_LINUX32_MIPS
+  #include "buildinf.mips32.h"
+#endif
+
+#ifdef ARCH_LINUX64_PPC
+  #include "buildinf.ppc64le.h"
+#endif
+
+#ifdef ARCH_LINUX64_S390X
+  #include "buildinf.s390x.h"
+#endif
+
 #ifdef ARCH_MACOS64
   #include "buildinf.macos64.h"
 #endif
 
+#ifdef ARCH_MACOS64_ARM64
+  #include "buildinf.macos64arm64.h"
+#endif
+
 #ifdef ARCH_IOS64
   #include "buildinf.ios64.h"
 #endif
+
+#ifdef ARCH_IOS64_SIMULATOR
+  #include "buildinf.iossim64.h"
+#endif
+
+#ifdef ARCH_WINDOWS64
+  #include "buildinf.mingw64.h"
+#endif
+
+#ifdef ARCH_WINDOWS32
+  #include "buildinf.mingw.h"
+#endif
+
+#if defined(ARCH_FREEBSD64) || defined(ARCH_OPENBSD64) || defined(ARCH_NETBSD64)
+  #include "buildinf.bsd64.h"
+#endif
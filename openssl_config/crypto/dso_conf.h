@@ -1,7 +1,11 @@
-#if defined(ARCH_LINUX64) || defined(ARCH_ANDROID64) || defined(ARCH_LINUX32) || defined(ARCH_ANDROID32)
+#if defined(ARCH_LINUX64) || defined(ARCH_ANDROID64) || defined(ARCH_LINUX32) || defined(ARCH_LINUX64_MIPS) || defined(ARCH_LINUX32_MIPS) || defined(ARCH_LINUX64_PPC) || defined(ARCH_LINUX64_S390X) || defined(ARCH_ANDROID32) || defined(ARCH_ANDROID32_X86) || defined(ARCH_FREEBSD64) || defined(ARCH_OPENBSD64) || defined(ARCH_NETBSD64)
   #include "dso_conf.linux.h"
 #endif
 
-#if defined(ARCH_MACOS64) || defined(ARCH_IOS64)
+#if defined(ARCH_MACOS64) || defined(ARCH_MACOS64_ARM64) || defined(ARCH_IOS64) || defined(ARCH_IOS64_SIMULATOR)
   #include "dso_conf.darwin.h"
 #endif
+
+#if defined(ARCH_WINDOWS64) || defined(ARCH_WINDOWS32)
+  #include "dso_conf.windows.h"
+#endif
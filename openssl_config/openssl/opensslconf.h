@@ -2,14 +2,51 @@
   #include "openssl/opensslconf.x64.h"
 #endif
 
-#if defined(ARCH_LINUX32) || defined(ARCH_ANDROID32)
+#if defined(ARCH_LINUX32) || defined(ARCH_ANDROID32_X86)
   #include "openssl/opensslconf.x86.h"
 #endif
 
-#ifdef ARCH_MACOS64
+#ifdef ARCH_ANDROID32
+  #include "openssl/opensslconf.android32.h"
+#endif
+
+#ifdef ARCH_LINUX64_MIPS
+  #include "openssl/opensslconf.mips64.h"
+#endif
+
+#ifdef ARCH_LINUX32_MIPS
+  #include "openssl/opensslconf.mips32.h"
+#endif
+
+#ifdef ARCH_LINUX64_PPC
+  #include "openssl/opensslconf.ppc64le.h"
+#endif
+
+#ifdef ARCH_LINUX64_S390X
+  #include "openssl/opensslconf.s390x.h"
+#endif
+
+#if defined(ARCH_MACOS64) || defined(ARCH_MACOS64_ARM64)
   #include "openssl/opensslconf.macos64.h"
 #endif
 
-#ifdef ARCH_IOS64
+#if defined(ARCH_IOS64) || defined(ARCH_IOS64_SIMULATOR)
   #include "openssl/opensslconf.ios64.h"
 #endif
+
+#ifdef ARCH_WINDOWS64
+  #include "openssl/opensslconf.mingw64.h"
+#endif
+
+#ifdef ARCH_WINDOWS32
+  #include "openssl/opensslconf.mingw.h"
+#endif
+
+#if defined(ARCH_FREEBSD64) || defined(ARCH_OPENBSD64) || defined(ARCH_NETBSD64)
+  #include "openssl/opensslconf.bsd64.h"
+#endif
+
+/* The assembly enabled builds (wrap.go --asm) still share the portable configs */
+#ifdef LIBTOR_OPENSSL_ASM
+  #undef OPENSSL_NO_ASM
+#endif